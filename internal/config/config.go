@@ -4,16 +4,34 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"runtime"
 )
 
 // Config 应用配置
 type Config struct {
-	Port       int    `json:"port"`        // 服务端口
-	Host       string `json:"host"`        // 服务地址
-	DataDir    string `json:"data_dir"`    // 数据存储目录
-	TempDir    string `json:"temp_dir"`    // 临时文件目录
-	OutputDir  string `json:"output_dir"`  // 输出文件目录
-	FFmpegPath string `json:"ffmpeg_path"` // FFmpeg 可执行文件路径
+	Port                int         `json:"port"`                  // 服务端口
+	Host                string      `json:"host"`                  // 服务地址
+	DataDir             string      `json:"data_dir"`              // 数据存储目录
+	TempDir             string      `json:"temp_dir"`              // 临时文件目录
+	OutputDir           string      `json:"output_dir"`            // 输出文件目录
+	StoreDir            string      `json:"store_dir"`             // 任务/上传记录持久化目录
+	FFmpegPath          string      `json:"ffmpeg_path"`           // FFmpeg 可执行文件路径
+	MaxGPUJobs          int         `json:"max_gpu_jobs"`          // GPU 编码任务最大并发数
+	MaxCPUJobs          int         `json:"max_cpu_jobs"`          // CPU 编码任务最大并发数
+	MaxLiveJobs         int         `json:"max_live_jobs"`         // 实时接收转换最大并发数
+	MaxGPUSessions      int         `json:"max_gpu_sessions"`      // 硬件编码同时会话数上限(转换与切割共享),0 表示不限制
+	MaxSplitWorkers     int         `json:"max_split_workers"`     // 单个切割任务同时处理的最大片段数
+	TrashDir            string      `json:"trash_dir"`             // 回收站目录
+	TrashRetentionHours int         `json:"trash_retention_hours"` // 回收站文件保留时长(小时),0 表示直接删除
+	Ladder              []Rendition `json:"ladder,omitempty"`      // 码率阶梯,转换请求 options.ladder 为 true 时使用,为空时使用默认阶梯
+}
+
+// Rendition 码率阶梯中的一档
+type Rendition struct {
+	Name         string `json:"name"`                   // 名称,用作子播放列表文件名,如 720p
+	Height       int    `json:"height,omitempty"`       // 视频高度,0 表示纯音频
+	VideoBitrate int    `json:"videoBitrate,omitempty"` // 视频码率(kbps)
+	AudioBitrate int    `json:"audioBitrate,omitempty"` // 音频码率(kbps),0 表示不含音频
 }
 
 // Load 加载配置
@@ -26,6 +44,20 @@ func Load() (*Config, error) {
 		DataDir:   filepath.Join(baseDir, "data"),
 		TempDir:   filepath.Join(baseDir, "temp"),
 		OutputDir: filepath.Join(baseDir, "output"),
+		StoreDir:  filepath.Join(baseDir, "store"),
+		TrashDir:  filepath.Join(baseDir, "trash"),
+		// 消费级 NVENC 等硬件编码器通常限制同时会话数,默认保守取 2
+		MaxGPUJobs: 2,
+		// libx264 本身会占满多个核心,默认每 4 核运行一个任务
+		MaxCPUJobs: max(runtime.NumCPU()/4, 1),
+		// 实时接收必须跟上录制速度,单独预留工作槽,默认同时处理 2 路录制
+		MaxLiveJobs: 2,
+		// 消费级显卡驱动限制 NVENC 同时会话数,转换和切割的硬件编码合计不超过该值
+		MaxGPUSessions: 3,
+		// 切割片段通常较短,使用 ultrafast 预设,默认每 2 核处理一个片段
+		MaxSplitWorkers: max(runtime.NumCPU()/2, 1),
+		// 切割后的源文件默认保留一天,期间可以恢复或重新切割
+		TrashRetentionHours: 24,
 	}
 
 	// 尝试从配置文件加载
@@ -35,7 +67,7 @@ func Load() (*Config, error) {
 	}
 
 	// 确保所有目录存在
-	dirs := []string{cfg.DataDir, cfg.TempDir, cfg.OutputDir}
+	dirs := []string{cfg.DataDir, cfg.TempDir, cfg.OutputDir, cfg.StoreDir, cfg.TrashDir}
 	for _, dir := range dirs {
 		if err := os.MkdirAll(dir, 0755); err != nil {
 			return nil, err
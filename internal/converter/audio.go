@@ -0,0 +1,147 @@
+package converter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"goalfy-mediaconverter/internal/probe"
+	"goalfy-mediaconverter/internal/progress"
+)
+
+// ErrNoAudio 输入文件没有音频流
+var ErrNoAudio = errors.New("输入文件没有音频流")
+
+// copyCodecs 各音频格式可以直接复制(不重新编码)的源编码
+var copyCodecs = map[string][]string{
+	"mp3":  {"mp3"},
+	"m4a":  {"aac", "alac"},
+	"opus": {"opus"},
+	"flac": {"flac"},
+	"wav":  {"pcm_s16le"},
+	"ogg":  {"vorbis"},
+}
+
+// losslessAudio 无损音频格式,不支持设置码率
+var losslessAudio = map[string]bool{"wav": true, "flac": true}
+
+// AudioOptions 音频提取参数
+type AudioOptions struct {
+	Format   string `json:"format"`             // 输出格式 mp3/m4a/opus/wav/flac/ogg,默认 mp3
+	Bitrate  int    `json:"bitrate,omitempty"`  // 音频码率(kbps),仅有损格式
+	Channels int    `json:"channels,omitempty"` // 声道数,1 为单声道
+	Track    int    `json:"track,omitempty"`    // 音频流序号(从 0 开始),默认第一条音频流
+}
+
+// Validate 校验并规范化参数,返回的错误信息可直接返回给客户端
+func (o *AudioOptions) Validate() error {
+	if o.Format == "" {
+		o.Format = "mp3"
+	}
+	format, ok := LookupFormat(o.Format)
+	if !ok || !format.AudioOnly() || format.AudioCodec == "" {
+		return fmt.Errorf("不支持的音频格式: %s (可选 mp3/m4a/opus/wav/flac/ogg)", o.Format)
+	}
+	o.Format = format.Name
+
+	if o.Bitrate != 0 {
+		if losslessAudio[o.Format] {
+			return fmt.Errorf("无损格式 %s 不支持设置 bitrate", o.Format)
+		}
+		if o.Bitrate < 32 || o.Bitrate > 512 {
+			return fmt.Errorf("bitrate 超出范围: %d (32-512 kbps)", o.Bitrate)
+		}
+	}
+	if o.Channels != 0 && (o.Channels < 1 || o.Channels > 8) {
+		return fmt.Errorf("channels 超出范围: %d (1-8)", o.Channels)
+	}
+	if o.Track < 0 {
+		return fmt.Errorf("无效的 track: %d", o.Track)
+	}
+	return nil
+}
+
+// CheckAudio 检查输入文件是否有所选的音频流
+func (o *AudioOptions) CheckAudio(info *probe.MediaInfo) error {
+	tracks := audioStreams(info)
+	if len(tracks) == 0 {
+		return ErrNoAudio
+	}
+	if o.Track >= len(tracks) {
+		return fmt.Errorf("track 超出范围: %d (输入文件共 %d 条音频流)", o.Track, len(tracks))
+	}
+	return nil
+}
+
+// audioStreams 列出所有音频流
+func audioStreams(info *probe.MediaInfo) []probe.Stream {
+	var streams []probe.Stream
+	for _, stream := range info.Streams {
+		if stream.Type == "audio" {
+			streams = append(streams, stream)
+		}
+	}
+	return streams
+}
+
+// canCopy 源音频流是否可以不重新编码直接写入输出格式
+// 指定了码率或声道时需要重新编码
+func (o *AudioOptions) canCopy(source probe.Stream) bool {
+	if o.Bitrate != 0 || o.Channels != 0 {
+		return false
+	}
+	for _, codec := range copyCodecs[o.Format] {
+		if source.Codec == codec {
+			return true
+		}
+	}
+	return false
+}
+
+// ExtractAudio 提取或转码音频,源编码与输出格式一致时直接复制音频流
+// 输入可以是视频或纯音频文件,视频、字幕和封面图片都会被丢弃
+// 转换过程中通过 updates 通道报告进度,结束时关闭通道
+func (c *Converter) ExtractAudio(ctx context.Context, inputPath, outputPath string, opts *AudioOptions, updates chan<- progress.Progress) error {
+	defer close(updates)
+
+	info, err := c.prober.Probe(ctx, inputPath)
+	if err != nil {
+		return fmt.Errorf("获取媒体信息失败: %v", err)
+	}
+	if err := opts.CheckAudio(info); err != nil {
+		return err
+	}
+
+	format, ok := LookupFormat(opts.Format)
+	if !ok {
+		return fmt.Errorf("不支持的音频格式: %s", opts.Format)
+	}
+	source := audioStreams(info)[opts.Track]
+
+	args := []string{
+		"-i", inputPath,
+		"-map", "0:a:" + strconv.Itoa(opts.Track),
+		"-vn", "-sn", "-dn",
+	}
+	if opts.canCopy(source) {
+		log.Printf("📋 音频编码 %s 与输出格式一致,直接复制音频流", source.Codec)
+		args = append(args, "-c:a", "copy")
+	} else {
+		log.Printf("🎵 转码音频: %s -> %s", source.Codec, format.AudioCodec)
+		args = append(args, "-c:a", format.AudioCodec)
+		if opts.Bitrate > 0 {
+			args = append(args, "-b:a", fmt.Sprintf("%dk", opts.Bitrate))
+		}
+		if opts.Channels > 0 {
+			args = append(args, "-ac", strconv.Itoa(opts.Channels))
+		}
+	}
+	args = append(args, "-f", format.Muxer)
+	args = append(args, format.muxerArgs(outputPath)...)
+	args = append(args, progress.Args()...)
+	args = append(args, "-y", outputPath)
+
+	return c.runWithProgress(ctx, args, info.Duration, updates)
+}
@@ -1,23 +1,36 @@
 package converter
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
 
+	"goalfy-mediaconverter/internal/ffmpeg"
 	"goalfy-mediaconverter/internal/gpu"
+	"goalfy-mediaconverter/internal/probe"
+	"goalfy-mediaconverter/internal/progress"
 )
 
 // Converter FFmpeg 转换器
 type Converter struct {
-	ffmpegPath string
-	gpuConfig  *gpu.Config
+	ffmpegPath  string
+	tempDir     string
+	gpuConfig   *gpu.Config
+	gpuSessions *gpu.Sessions // 与切割器共享的硬件编码会话限制器
+	prober      *probe.Prober
 }
 
 // New 创建转换器
-func New(ffmpegPath string) *Converter {
+// tempDir 用于流转换时缓存输入,以便 GPU 失败后重放;gpuSessions 为与切割器共享的硬件编码会话限制器
+func New(ffmpegPath, tempDir string, gpuSessions *gpu.Sessions) *Converter {
 	// 自动检测 GPU 加速
 	detector := gpu.NewDetector(ffmpegPath)
 	gpuConfig := detector.DetectGPU()
@@ -31,57 +44,96 @@ func New(ffmpegPath string) *Converter {
 	}
 
 	return &Converter{
-		ffmpegPath: ffmpegPath,
-		gpuConfig:  gpuConfig,
+		ffmpegPath:  ffmpegPath,
+		tempDir:     tempDir,
+		gpuConfig:   gpuConfig,
+		gpuSessions: gpuSessions,
+		prober:      probe.New(ffmpegPath),
 	}
 }
 
+// UsesGPU 按给定格式和选项转换时是否使用 GPU 硬件编码
+func (c *Converter) UsesGPU(format *Format, opts *ConvertOptions) bool {
+	return c.gpuConfig.Enabled && opts.gpuCompatible(format)
+}
+
+// streamCommitThreshold GPU 流转换时输出缓存的上限
+// 输出超过该大小后才写入客户端,在此之前失败可以丢弃输出并安全回退到 CPU
+// 这里假设硬件编码失败发生在编码器打开时(设备不可用、会话数超限、分辨率或 profile 不支持),
+// 即第一个视频分片输出之前:empty_moov 的文件头只有几 KB,1MB 在常见码率下相当于数秒的视频
+// 超过该大小后才失败(如驱动崩溃)时无法回退,只能返回错误,客户端已收到的数据不完整
+const streamCommitThreshold = 1 << 20
+
 // ConvertStream 同步转换视频流 (WebM -> MP4)
+// GPU 编码失败时使用已缓存的输入重新以 CPU 编码,失败的 GPU 输出不会写入 output
 func (c *Converter) ConvertStream(ctx context.Context, input io.Reader, output io.Writer) error {
-	var args []string
-
-	if c.gpuConfig.Enabled {
-		// GPU 加速模式
-		log.Printf("🎮 使用 %s GPU 加速进行流转换", c.gpuConfig.AccelType)
+	source := newStreamInput(input)
+	defer source.Close()
 
-		// 添加硬件加速参数
-		args = append(args, c.gpuConfig.ExtraArgs...)
+	if !c.gpuConfig.Enabled {
+		// CPU 模式
+		log.Println("💻 使用 CPU 编码进行流转换")
+		return c.runStream(ctx, c.streamArgs(false), source.Reader, output)
+	}
 
-		// 如果有硬件解码器
-		if c.gpuConfig.DecodeCodec != "" {
-			args = append(args, "-c:v", c.gpuConfig.DecodeCodec)
+	// GPU 加速模式
+	log.Printf("🎮 使用 %s GPU 加速进行流转换", c.gpuConfig.AccelType)
+	if !c.gpuConfig.FallbackCPU {
+		release, err := c.gpuSessions.Acquire(ctx, 1)
+		if err != nil {
+			return err
 		}
+		defer release()
+		return c.runStream(ctx, c.streamArgs(true), source.Reader, output)
+	}
 
-		// 输入
-		args = append(args, "-i", "pipe:0")
-
-		// GPU 编码器
-		args = append(args, "-c:v", c.gpuConfig.EncodeCodec)
-		args = append(args, "-c:a", "aac")
-
-		// 根据 GPU 类型设置参数
-		switch c.gpuConfig.AccelType {
-		case gpu.AccelNVIDIA:
-			args = append(args, "-preset", "p4", "-cq", "23")
-		case gpu.AccelAMD:
-			args = append(args, "-rc", "cqp", "-qp", "23")
-		case gpu.AccelIntel:
-			args = append(args, "-global_quality", "23")
-		case gpu.AccelVideoToolbox:
-			args = append(args,
-				"-b:v", "0",
-				"-q:v", "65",
-				"-realtime", "1",
-				"-allow_sw", "1",
-			)
-		}
+	// 将 GPU 进程读取的输入同时写入临时文件,回退时可以从头重放
+	spool, err := os.CreateTemp(c.tempDir, "stream-*.webm")
+	if err != nil {
+		return fmt.Errorf("创建临时文件失败: %v", err)
+	}
+	defer func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}()
 
-		args = append(args, "-movflags", "frag_keyframe+empty_moov")
-		args = append(args, "-f", "mp4", "pipe:1")
-	} else {
-		// CPU 模式
-		log.Println("💻 使用 CPU 编码进行流转换")
-		args = []string{
+	release, err := c.gpuSessions.Acquire(ctx, 1)
+	if err != nil {
+		return err
+	}
+	fenced := &fencedWriter{w: output, threshold: streamCommitThreshold}
+	err = c.runStream(ctx, c.streamArgs(true), func(stop <-chan struct{}) io.Reader {
+		return io.TeeReader(source.Reader(stop), spool)
+	}, fenced)
+	release()
+	if err == nil {
+		return fenced.Commit()
+	}
+	if ctx.Err() != nil {
+		return err
+	}
+	if fenced.committed {
+		// 已有数据写入客户端,无法再回退
+		return fmt.Errorf("GPU 编码在输出 %d 字节后失败: %v", fenced.written, err)
+	}
+
+	log.Printf("⚠️  GPU 编码失败: %v", err)
+	log.Println("🔄 尝试使用 CPU 编码...")
+
+	// 丢弃 GPU 的输出,重放已读取的输入,再继续读取剩余的输入
+	fenced.Discard()
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("重放输入失败: %v", err)
+	}
+	return c.runStream(ctx, c.streamArgs(false), func(stop <-chan struct{}) io.Reader {
+		return io.MultiReader(spool, source.Reader(stop))
+	}, output)
+}
+
+// streamArgs 构建流转换的 FFmpeg 参数,输入输出均为管道
+func (c *Converter) streamArgs(useGPU bool) []string {
+	if !useGPU {
+		return []string{
 			"-i", "pipe:0",
 			"-c:v", "libx264",
 			"-c:a", "aac",
@@ -91,183 +143,356 @@ func (c *Converter) ConvertStream(ctx context.Context, input io.Reader, output i
 		}
 	}
 
+	var args []string
+
+	// 添加硬件加速参数
+	args = append(args, c.gpuConfig.ExtraArgs...)
+
+	// 如果有硬件解码器
+	if c.gpuConfig.DecodeCodec != "" {
+		args = append(args, "-c:v", c.gpuConfig.DecodeCodec)
+	}
+
+	// 输入
+	args = append(args, "-i", "pipe:0")
+
+	// GPU 编码器
+	args = append(args, "-c:v", c.gpuConfig.EncodeCodec)
+	args = append(args, "-c:a", "aac")
+
+	// 根据 GPU 类型设置参数
+	switch c.gpuConfig.AccelType {
+	case gpu.AccelNVIDIA:
+		args = append(args, "-preset", "p4", "-cq", "23")
+	case gpu.AccelAMD:
+		args = append(args, "-rc", "cqp", "-qp", "23")
+	case gpu.AccelIntel:
+		args = append(args, "-global_quality", "23")
+	case gpu.AccelVideoToolbox:
+		args = append(args,
+			"-b:v", "0",
+			"-q:v", "65",
+			"-realtime", "1",
+			"-allow_sw", "1",
+		)
+	}
+
+	args = append(args, "-movflags", "frag_keyframe+empty_moov")
+	args = append(args, "-f", "mp4", "pipe:1")
+	return args
+}
+
+// runStream 以管道方式执行一次 FFmpeg 流转换
+// input 返回本次转换读取的输入,stop 关闭后读取立即返回;FFmpeg 提前退出时不必等待输入读完
+func (c *Converter) runStream(ctx context.Context, args []string, input func(stop <-chan struct{}) io.Reader, output io.Writer) error {
 	cmd := exec.CommandContext(ctx, c.ffmpegPath, args...)
-	cmd.Stdin = input
 	cmd.Stdout = output
 
-	// 捕获 stderr 以便记录详细错误信息
-	stderrPipe, err := cmd.StderrPipe()
+	// 只保留 stderr 末尾部分,用于失败时的错误信息
+	stderr := ffmpeg.NewTailBuffer()
+	cmd.Stderr = stderr
+
+	stdin, err := cmd.StdinPipe()
 	if err != nil {
-		return fmt.Errorf("创建 stderr 管道失败: %v", err)
+		return fmt.Errorf("创建输入管道失败: %v", err)
 	}
-
-	// 启动命令
 	if err := cmd.Start(); err != nil {
 		return fmt.Errorf("启动 FFmpeg 失败: %v", err)
 	}
 
-	// 读取 stderr 输出
-	stderrBytes, _ := io.ReadAll(stderrPipe)
+	stop := make(chan struct{})
+	copied := make(chan struct{})
+	go func() {
+		defer close(copied)
+		io.Copy(stdin, input(stop))
+		stdin.Close()
+	}()
 
-	// 等待命令完成
+	// Wait 在进程退出后关闭输入管道,再停止读取,复制协程随即退出
 	err = cmd.Wait()
+	close(stop)
+	<-copied
 
-	// GPU 失败时回退到 CPU
-	if err != nil && c.gpuConfig.Enabled && c.gpuConfig.FallbackCPU {
-		log.Printf("⚠️  GPU 编码失败: %v", err)
-		log.Println("🔄 尝试使用 CPU 编码...")
+	if err != nil {
+		return fmt.Errorf("FFmpeg 转换失败: %v\nFFmpeg 输出:\n%s", err, stderr.String())
+	}
+	return nil
+}
 
-		// 重新构建 CPU 命令
-		cpuArgs := []string{
-			"-i", "pipe:0",
-			"-c:v", "libx264",
-			"-c:a", "aac",
-			"-movflags", "frag_keyframe+empty_moov",
-			"-f", "mp4",
-			"pipe:1",
-		}
+// fencedWriter 在写入量达到 threshold 之前缓存输出,之后才写入下游
+// 未提交前可以丢弃已缓存的数据,下游不会收到任何内容
+type fencedWriter struct {
+	w         io.Writer
+	threshold int
+	buf       bytes.Buffer
+	committed bool
+	written   int64
+}
 
-		cmd = exec.CommandContext(ctx, c.ffmpegPath, cpuArgs...)
-		cmd.Stdin = input
-		cmd.Stdout = output
-		err = cmd.Run()
+func (f *fencedWriter) Write(p []byte) (int, error) {
+	if f.committed {
+		n, err := f.w.Write(p)
+		f.written += int64(n)
+		return n, err
 	}
 
-	if err != nil {
-		return fmt.Errorf("FFmpeg 转换失败: %v\nFFmpeg 输出:\n%s", err, string(stderrBytes))
+	f.buf.Write(p)
+	if f.buf.Len() >= f.threshold {
+		if err := f.Commit(); err != nil {
+			return 0, err
+		}
 	}
+	return len(p), nil
+}
 
-	return nil
+// Commit 将缓存的数据写入下游,此后的写入直接透传
+func (f *fencedWriter) Commit() error {
+	f.committed = true
+	n, err := f.w.Write(f.buf.Bytes())
+	f.written += int64(n)
+	f.buf.Reset()
+	return err
 }
 
-// ConvertFile 异步转换视频文件 (WebM -> MP4)
-func (c *Converter) ConvertFile(ctx context.Context, inputPath, outputPath string, progress chan<- int) error {
-	defer close(progress)
+// errStreamStopped 本次转换已结束,停止读取输入
+var errStreamStopped = errors.New("流转换已结束")
+
+// streamInput 在独立的协程中读取输入流
+// 网络读取可能长时间阻塞,FFmpeg 退出后通过 Reader 的 stop 立即停止读取;
+// 已从网络读出但尚未被消费的数据保留给下一次转换(CPU 回退),不会丢失
+type streamInput struct {
+	chunks  chan []byte   // 读取协程读出的数据
+	done    chan struct{} // 关闭后读取协程不再等待数据被消费
+	err     error         // chunks 关闭后表示读取结束的原因
+	pending []byte        // 已取出但尚未消费完的数据
+}
 
-	var args []string
+// newStreamInput 开始在后台读取 r
+func newStreamInput(r io.Reader) *streamInput {
+	s := &streamInput{
+		chunks: make(chan []byte),
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer close(s.chunks)
+		for {
+			buf := make([]byte, 32*1024)
+			n, err := r.Read(buf)
+			if n > 0 {
+				select {
+				case s.chunks <- buf[:n]:
+				case <-s.done:
+					return
+				}
+			}
+			if err != nil {
+				s.err = err
+				return
+			}
+		}
+	}()
+	return s
+}
 
-	if c.gpuConfig.Enabled {
-		// GPU 加速模式
-		log.Printf("🎮 使用 %s GPU 加速进行文件转换", c.gpuConfig.AccelType)
+// Reader 返回一次转换使用的 Reader,同一时间只能有一个 Reader 在读取
+func (s *streamInput) Reader(stop <-chan struct{}) io.Reader {
+	return &stoppableReader{input: s, stop: stop}
+}
 
-		// 添加硬件加速参数
-		args = append(args, c.gpuConfig.ExtraArgs...)
+// Close 停止读取协程,输入流本身由调用方关闭
+func (s *streamInput) Close() {
+	close(s.done)
+}
 
-		// 如果有硬件解码器
-		if c.gpuConfig.DecodeCodec != "" {
-			args = append(args, "-c:v", c.gpuConfig.DecodeCodec)
-		}
+// stoppableReader 从 streamInput 读取,stop 关闭后返回 errStreamStopped
+type stoppableReader struct {
+	input *streamInput
+	stop  <-chan struct{}
+}
 
-		// 输入
-		args = append(args, "-i", inputPath)
-
-		// GPU 编码器
-		args = append(args, "-c:v", c.gpuConfig.EncodeCodec)
-		args = append(args, "-c:a", "aac")
-
-		// 根据 GPU 类型设置参数
-		switch c.gpuConfig.AccelType {
-		case gpu.AccelNVIDIA:
-			args = append(args, "-preset", "p4", "-cq", "23")
-		case gpu.AccelAMD:
-			args = append(args, "-rc", "cqp", "-qp", "23")
-		case gpu.AccelIntel:
-			args = append(args, "-preset", "medium", "-global_quality", "23")
-		case gpu.AccelVideoToolbox:
-			args = append(args,
-				"-b:v", "0",
-				"-q:v", "65",
-				"-realtime", "1",
-				"-allow_sw", "1",
-			)
+func (r *stoppableReader) Read(p []byte) (int, error) {
+	s := r.input
+	if len(s.pending) == 0 {
+		select {
+		case chunk, ok := <-s.chunks:
+			if !ok {
+				return 0, s.err
+			}
+			s.pending = chunk
+		case <-r.stop:
+			return 0, errStreamStopped
 		}
+	}
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
 
-		args = append(args, "-y", outputPath)
-	} else {
-		// CPU 模式
-		log.Println("💻 使用 CPU 编码进行文件转换")
-		args = []string{
-			"-i", inputPath,
-			"-c:v", "libx264",
-			"-c:a", "aac",
-			"-preset", "medium",
-			"-crf", "23",
-			"-y",
-			outputPath,
+// Discard 丢弃尚未提交的数据
+func (f *fencedWriter) Discard() {
+	f.buf.Reset()
+}
+
+// ConvertFile 异步转换媒体文件到指定格式
+// 转换过程中通过 updates 通道报告真实进度,结束时关闭通道
+func (c *Converter) ConvertFile(ctx context.Context, inputPath, outputPath string, format *Format, opts *ConvertOptions, updates chan<- progress.Progress) error {
+	defer close(updates)
+
+	// 探测输入时长,用于计算百分比和剩余时间
+	duration, err := c.ProbeDuration(ctx, inputPath)
+	if err != nil {
+		log.Printf("⚠️  无法获取输入时长,进度将只报告已处理时长: %v", err)
+	}
+
+	// 恒定帧率未指定 fps 时,按输入平均帧率取整
+	if opts.ConstantFrameRate && opts.FPS == 0 && !format.AudioOnly() {
+		cfr := *opts
+		cfr.FPS = 30
+		if info, err := c.prober.Probe(ctx, inputPath); err == nil && info.Video != nil {
+			cfr.FPS = cfrRate(info.Video.FrameRate)
 		}
+		log.Printf("🎞️  输出恒定帧率: %g fps", cfr.FPS)
+		opts = &cfr
 	}
 
-	cmd := exec.CommandContext(ctx, c.ffmpegPath, args...)
-	stderr, _ := cmd.StderrPipe()
+	if format.Segmented() {
+		if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+			return fmt.Errorf("创建输出目录失败: %v", err)
+		}
+	}
 
-	if err := cmd.Start(); err != nil {
-		return err
+	useGPU := c.UsesGPU(format, opts)
+	if useGPU {
+		log.Printf("🎮 使用 %s GPU 加速进行文件转换", c.gpuConfig.AccelType)
+	} else {
+		log.Println("💻 使用 CPU 编码进行文件转换")
 	}
 
-	// 读取 stderr 输出(可以解析进度信息)
-	go func() {
-		buf := make([]byte, 1024)
-		for {
-			n, err := stderr.Read(buf)
-			if err != nil {
-				break
-			}
-			_ = n // 这里可以解析 FFmpeg 输出来更新进度
-			// 简化版:每次读取都报告进度增加
-			select {
-			case progress <- 10: // 简化的进度更新
-			default:
-			}
+	if useGPU {
+		// 码率阶梯的每一档各占一路编码会话
+		var release func()
+		if release, err = c.gpuSessions.Acquire(ctx, max(len(opts.Renditions), 1)); err != nil {
+			return err
 		}
-	}()
-
-	err := cmd.Wait()
+		err = c.runWithProgress(ctx, c.fileArgs(inputPath, outputPath, format, opts, true), duration, updates)
+		release()
+	} else {
+		err = c.runWithProgress(ctx, c.fileArgs(inputPath, outputPath, format, opts, false), duration, updates)
+	}
 
 	// GPU 失败时回退到 CPU
-	if err != nil && c.gpuConfig.Enabled && c.gpuConfig.FallbackCPU {
+	if err != nil && ctx.Err() == nil && useGPU && c.gpuConfig.FallbackCPU {
 		log.Printf("⚠️  GPU 编码失败: %v", err)
 		log.Println("🔄 尝试使用 CPU 编码...")
 
-		// CPU 回退
-		cpuArgs := []string{
-			"-i", inputPath,
-			"-c:v", "libx264",
-			"-c:a", "aac",
-			"-preset", "medium",
-			"-crf", "23",
-			"-y",
-			outputPath,
+		// 分片数量可能与 GPU 尝试不同,清空目录避免残留旧分片
+		if format.Segmented() {
+			dir := filepath.Dir(outputPath)
+			os.RemoveAll(dir)
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return fmt.Errorf("创建输出目录失败: %v", err)
+			}
 		}
 
-		cmd = exec.CommandContext(ctx, c.ffmpegPath, cpuArgs...)
-		stderr, _ := cmd.StderrPipe()
+		err = c.runWithProgress(ctx, c.fileArgs(inputPath, outputPath, format, opts, false), duration, updates)
+	}
 
-		if err := cmd.Start(); err != nil {
-			return err
+	return err
+}
+
+// fileArgs 构建文件转换参数
+func (c *Converter) fileArgs(inputPath, outputPath string, format *Format, opts *ConvertOptions, useGPU bool) []string {
+	var args []string
+	accel := gpu.AccelNone
+
+	if useGPU {
+		accel = c.gpuConfig.AccelType
+
+		// 添加硬件加速参数
+		args = append(args, c.gpuConfig.ExtraArgs...)
+
+		// 如果有硬件解码器
+		if c.gpuConfig.DecodeCodec != "" {
+			args = append(args, "-c:v", c.gpuConfig.DecodeCodec)
 		}
+	}
 
-		// 读取 stderr 输出
-		go func() {
-			buf := make([]byte, 1024)
-			for {
-				n, err := stderr.Read(buf)
-				if err != nil {
-					break
-				}
-				_ = n
-				select {
-				case progress <- 10:
-				default:
-				}
+	args = append(args, "-i", inputPath)
+
+	// 码率阶梯自行映射各档位的输出流
+	ladder := len(opts.Renditions) > 0 && format.Segmented()
+
+	// 音频偏移: 以偏移后的时间戳再读入一次输入,只取其中的音频
+	audioInput := "0"
+	if opts.AudioOffset != 0 && format.AudioCodec != "" {
+		args = append(args, "-itsoffset", strconv.FormatFloat(opts.AudioOffset, 'f', -1, 64), "-i", inputPath)
+		audioInput = "1"
+		if !ladder {
+			if !format.AudioOnly() {
+				args = append(args, "-map", "0:v:0")
 			}
-		}()
+			args = append(args, "-map", "1:a:0?")
+		}
+	}
 
-		err = cmd.Wait()
+	if ladder {
+		ladderArgs, output := c.ladderArgs(outputPath, format, opts, accel, audioInput)
+		args = append(args, ladderArgs...)
+		args = append(args, progress.Args()...)
+		return append(args, "-y", output)
 	}
 
-	return err
+	args = append(args, opts.videoArgs(c.gpuConfig, accel, format)...)
+	if format.Segmented() {
+		// 在分片边界强制关键帧,保证每个分片都能独立解码、时长一致
+		args = append(args, "-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", segmentDuration))
+	}
+	args = append(args, opts.audioArgs(format)...)
+	args = append(args, "-f", format.Muxer)
+	args = append(args, format.muxerArgs(outputPath)...)
+	args = append(args, progress.Args()...)
+	return append(args, "-y", outputPath)
+}
+
+// runWithProgress 执行 FFmpeg 并将 -progress 输出解析后转发到 updates
+func (c *Converter) runWithProgress(ctx context.Context, args []string, duration float64, updates chan<- progress.Progress) error {
+	err := ffmpeg.RunWithProgress(ctx, c.ffmpegPath, args, duration, func(p progress.Progress) {
+		// 丢弃来不及消费的旧进度,避免阻塞 FFmpeg 输出
+		select {
+		case updates <- p:
+		default:
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("FFmpeg 转换失败: %v", err)
+	}
+	return nil
+}
+
+// ProbeDuration 获取媒体文件时长(秒)
+// 优先使用 ffprobe,不可用时解析 ffmpeg -i 输出中的 "Duration: HH:MM:SS.xx" 行
+func (c *Converter) ProbeDuration(ctx context.Context, inputPath string) (float64, error) {
+	if info, err := c.prober.Probe(ctx, inputPath); err == nil && info.Duration > 0 {
+		return info.Duration, nil
+	}
+
+	// ffmpeg 在未指定输出时会以非零状态退出,这里只关心 stderr 内容
+	out, _ := exec.CommandContext(ctx, c.ffmpegPath, "-hide_banner", "-i", inputPath).CombinedOutput()
+
+	match := durationPattern.FindStringSubmatch(string(out))
+	if match == nil {
+		return 0, fmt.Errorf("FFmpeg 输出中没有时长信息")
+	}
+
+	hours, _ := strconv.ParseFloat(match[1], 64)
+	minutes, _ := strconv.ParseFloat(match[2], 64)
+	seconds, _ := strconv.ParseFloat(match[3], 64)
+	return hours*3600 + minutes*60 + seconds, nil
 }
 
+// durationPattern 匹配 ffmpeg -i 输出的时长行(MediaRecorder 生成的 WebM 为 N/A,不会匹配)
+var durationPattern = regexp.MustCompile(`Duration:\s*(\d+):(\d{2}):(\d{2}(?:\.\d+)?)`)
+
 // Validate 验证 FFmpeg 是否可用
 func (c *Converter) Validate() error {
 	cmd := exec.Command(c.ffmpegPath, "-version")
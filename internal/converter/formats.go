@@ -0,0 +1,196 @@
+package converter
+
+import (
+	"mime"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Format 输出格式定义
+type Format struct {
+	Name       string   // 格式名称,即请求中的 outputFormat
+	Extension  string   // 文件扩展名(含点)
+	MIMEType   string   // 下载时的 Content-Type
+	Muxer      string   // FFmpeg 封装器(-f)
+	MuxerArgs  []string // 封装器参数
+	VideoCodec string   // CPU 视频编码器,为空表示纯音频格式
+	AudioCodec string   // 音频编码器,为空表示不含音频
+	GPU        bool     // 是否可以使用 GPU H.264 编码器
+	Playlist   string   // 分段格式的入口文件名(播放列表),为空表示输出单个文件
+}
+
+// AudioOnly 是否为纯音频格式
+func (f *Format) AudioOnly() bool {
+	return f.VideoCodec == ""
+}
+
+// Segmented 是否为分段格式
+// 分段格式输出一个播放列表和多个分片,全部放在以任务ID命名的目录中
+func (f *Format) Segmented() bool {
+	return f.Playlist != ""
+}
+
+// OutputPath 获取输出路径,分段格式返回任务目录中的播放列表路径
+func (f *Format) OutputPath(outputDir, id string) string {
+	if f.Segmented() {
+		return filepath.Join(outputDir, id, f.Playlist)
+	}
+	return filepath.Join(outputDir, id+f.Extension)
+}
+
+// muxerArgs 获取封装器参数,分段格式的分片与播放列表写在同一目录
+func (f *Format) muxerArgs(outputPath string) []string {
+	args := append([]string{}, f.MuxerArgs...)
+	if f.Muxer == "hls" {
+		args = append(args, "-hls_segment_filename", filepath.Join(filepath.Dir(outputPath), "segment_%05d.ts"))
+	}
+	return args
+}
+
+// segmentDuration 分段格式每个分片的目标时长(秒)
+const segmentDuration = 6
+
+// formats 支持的输出格式
+var formats = map[string]*Format{
+	"mp4": {
+		Name: "mp4", Extension: ".mp4", MIMEType: "video/mp4",
+		Muxer: "mp4", MuxerArgs: []string{"-movflags", "+faststart"},
+		VideoCodec: "libx264", AudioCodec: "aac", GPU: true,
+	},
+	"mov": {
+		Name: "mov", Extension: ".mov", MIMEType: "video/quicktime",
+		Muxer: "mov", MuxerArgs: []string{"-movflags", "+faststart"},
+		VideoCodec: "libx264", AudioCodec: "aac", GPU: true,
+	},
+	"mkv": {
+		Name: "mkv", Extension: ".mkv", MIMEType: "video/x-matroska",
+		Muxer:      "matroska",
+		VideoCodec: "libx264", AudioCodec: "aac", GPU: true,
+	},
+	"webm": {
+		Name: "webm", Extension: ".webm", MIMEType: "video/webm",
+		Muxer:      "webm",
+		VideoCodec: "libvpx-vp9", AudioCodec: "libopus",
+	},
+	"gif": {
+		Name: "gif", Extension: ".gif", MIMEType: "image/gif",
+		Muxer:      "gif",
+		VideoCodec: "gif",
+	},
+	"hls": {
+		Name: "hls", Extension: ".m3u8", MIMEType: "application/vnd.apple.mpegurl",
+		Muxer: "hls", MuxerArgs: []string{"-hls_time", strconv.Itoa(segmentDuration), "-hls_playlist_type", "vod", "-hls_flags", "independent_segments"},
+		VideoCodec: "libx264", AudioCodec: "aac", GPU: true,
+		Playlist: "index.m3u8",
+	},
+	"dash": {
+		Name: "dash", Extension: ".mpd", MIMEType: "application/dash+xml",
+		Muxer: "dash", MuxerArgs: dashArgs,
+		VideoCodec: "libx264", AudioCodec: "aac", GPU: true,
+		Playlist: "manifest.mpd",
+	},
+	"cmaf": {
+		// 同一组 fMP4 分片同时被 DASH 清单和 HLS 播放列表引用,只编码、存储一次
+		Name: "cmaf", Extension: ".mpd", MIMEType: "application/dash+xml",
+		Muxer: "dash", MuxerArgs: append([]string{"-hls_playlist", "1"}, dashArgs...),
+		VideoCodec: "libx264", AudioCodec: "aac", GPU: true,
+		Playlist: "manifest.mpd",
+	},
+	"mp3": {
+		Name: "mp3", Extension: ".mp3", MIMEType: "audio/mpeg",
+		Muxer:      "mp3",
+		AudioCodec: "libmp3lame",
+	},
+	"m4a": {
+		Name: "m4a", Extension: ".m4a", MIMEType: "audio/mp4",
+		Muxer: "ipod", MuxerArgs: []string{"-movflags", "+faststart"},
+		AudioCodec: "aac",
+	},
+	"wav": {
+		Name: "wav", Extension: ".wav", MIMEType: "audio/wav",
+		Muxer:      "wav",
+		AudioCodec: "pcm_s16le",
+	},
+	"ogg": {
+		Name: "ogg", Extension: ".ogg", MIMEType: "audio/ogg",
+		Muxer:      "ogg",
+		AudioCodec: "libvorbis",
+	},
+	"opus": {
+		Name: "opus", Extension: ".opus", MIMEType: "audio/ogg; codecs=opus",
+		Muxer:      "opus",
+		AudioCodec: "libopus",
+	},
+	"flac": {
+		Name: "flac", Extension: ".flac", MIMEType: "audio/flac",
+		Muxer:      "flac",
+		AudioCodec: "flac",
+	},
+}
+
+// dashArgs DASH 封装器参数,分片为 fMP4,文件名相对于清单所在目录
+var dashArgs = []string{
+	"-seg_duration", strconv.Itoa(segmentDuration),
+	"-dash_segment_type", "mp4",
+	"-use_template", "1",
+	"-use_timeline", "1",
+	"-init_seg_name", "init-$RepresentationID$.m4s",
+	"-media_seg_name", "chunk-$RepresentationID$-$Number%05d$.m4s",
+}
+
+// segmentMIMETypes 分段格式中分片文件的 MIME 类型
+var segmentMIMETypes = map[string]string{
+	".ts":  "video/mp2t",
+	".m4s": "video/iso.segment",
+}
+
+// sidecarMIMETypes 缩略图等附属文件的 MIME 类型(标准库未必内置)
+var sidecarMIMETypes = map[string]string{
+	".vtt": "text/vtt; charset=utf-8",
+}
+
+// LookupFormat 按名称查找输出格式(不区分大小写)
+func LookupFormat(name string) (*Format, bool) {
+	f, ok := formats[strings.ToLower(name)]
+	return f, ok
+}
+
+// FormatNames 返回所有支持的格式名称
+func FormatNames() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// MIMETypeFor 根据文件路径的扩展名获取 MIME 类型
+func MIMETypeFor(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, f := range formats {
+		if f.Extension == ext {
+			return f.MIMEType
+		}
+	}
+	if mimeType, ok := segmentMIMETypes[ext]; ok {
+		return mimeType
+	}
+	return "application/octet-stream"
+}
+
+// RegisterMIMETypes 向标准库注册输出格式的 MIME 类型
+// 使静态文件服务(/downloads)返回正确的 Content-Type
+func RegisterMIMETypes() {
+	for _, f := range formats {
+		mime.AddExtensionType(f.Extension, f.MIMEType)
+	}
+	for ext, mimeType := range segmentMIMETypes {
+		mime.AddExtensionType(ext, mimeType)
+	}
+	for ext, mimeType := range sidecarMIMETypes {
+		mime.AddExtensionType(ext, mimeType)
+	}
+}
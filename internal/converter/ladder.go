@@ -0,0 +1,302 @@
+package converter
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"goalfy-mediaconverter/internal/gpu"
+	"goalfy-mediaconverter/internal/probe"
+)
+
+// Rendition 码率阶梯中的一档
+type Rendition struct {
+	Name         string `json:"name"`                   // 名称,用作子播放列表文件名,如 720p
+	Height       int    `json:"height,omitempty"`       // 视频高度,0 表示纯音频
+	VideoBitrate int    `json:"videoBitrate,omitempty"` // 视频码率(kbps)
+	AudioBitrate int    `json:"audioBitrate,omitempty"` // 音频码率(kbps),0 表示不含音频
+}
+
+// RenditionResult 码率阶梯中一档的转换结果
+type RenditionResult struct {
+	Rendition
+	Skipped  bool   `json:"skipped,omitempty"`  // 是否被跳过(高于源分辨率或源文件没有对应的流)
+	Reason   string `json:"reason,omitempty"`   // 跳过原因
+	Playlist string `json:"playlist,omitempty"` // HLS 子播放列表路径
+	URL      string `json:"url,omitempty"`      // 子播放列表通过 /downloads 访问的地址
+}
+
+// maxRenditions 码率阶梯的最大档数
+const maxRenditions = 8
+
+// renditionNamePattern 档位名称只允许用作文件名的安全字符
+var renditionNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// DefaultLadder 默认码率阶梯,config.json 中未配置 ladder 时使用
+func DefaultLadder() []Rendition {
+	return []Rendition{
+		{Name: "1080p", Height: 1080, VideoBitrate: 5000, AudioBitrate: 128},
+		{Name: "720p", Height: 720, VideoBitrate: 2800, AudioBitrate: 128},
+		{Name: "480p", Height: 480, VideoBitrate: 1200, AudioBitrate: 96},
+		{Name: "audio", AudioBitrate: 96},
+	}
+}
+
+// ValidateLadder 校验码率阶梯
+func ValidateLadder(renditions []Rendition) error {
+	if len(renditions) == 0 {
+		return fmt.Errorf("码率阶梯不能为空")
+	}
+	if len(renditions) > maxRenditions {
+		return fmt.Errorf("码率阶梯最多 %d 档", maxRenditions)
+	}
+
+	names := make(map[string]bool)
+	hasVideo := false
+	for _, r := range renditions {
+		if !renditionNamePattern.MatchString(r.Name) {
+			return fmt.Errorf("无效的档位名称: %q (只允许字母、数字、- 和 _)", r.Name)
+		}
+		if names[r.Name] {
+			return fmt.Errorf("档位名称重复: %s", r.Name)
+		}
+		names[r.Name] = true
+
+		if r.Height != 0 {
+			if r.Height < 144 || r.Height > 4320 || r.Height%2 != 0 {
+				return fmt.Errorf("档位 %s 的 height 无效: %d (144-4320 的偶数)", r.Name, r.Height)
+			}
+			if r.VideoBitrate < 100 || r.VideoBitrate > 200000 {
+				return fmt.Errorf("档位 %s 的 videoBitrate 超出范围: %d (100-200000 kbps)", r.Name, r.VideoBitrate)
+			}
+			hasVideo = true
+		} else if r.AudioBitrate == 0 {
+			return fmt.Errorf("纯音频档位 %s 必须设置 audioBitrate", r.Name)
+		}
+		if r.AudioBitrate != 0 && (r.AudioBitrate < 32 || r.AudioBitrate > 512) {
+			return fmt.Errorf("档位 %s 的 audioBitrate 超出范围: %d (32-512 kbps)", r.Name, r.AudioBitrate)
+		}
+	}
+	if !hasVideo {
+		return fmt.Errorf("码率阶梯至少需要一个视频档位")
+	}
+	return nil
+}
+
+// PlanLadder 根据源文件调整码率阶梯
+// 高于源分辨率的档位被跳过(不放大);所有视频档位都高于源分辨率时保留最低一档并降到源分辨率
+// 源文件没有音频时去掉各档的音频,纯音频档位被跳过。info 为 nil 时按原样使用
+func PlanLadder(info *probe.MediaInfo, renditions []Rendition) ([]Rendition, []RenditionResult, error) {
+	if info == nil {
+		results := make([]RenditionResult, len(renditions))
+		for i, r := range renditions {
+			results[i] = RenditionResult{Rendition: r}
+		}
+		return renditions, results, nil
+	}
+
+	sourceHeight := 0
+	if info.Video != nil {
+		sourceHeight = info.Video.Height
+		if info.Video.Rotation == 90 || info.Video.Rotation == 270 {
+			sourceHeight = info.Video.Width
+		}
+	}
+
+	// 所有视频档位都高于源分辨率时,保留的最低一档
+	fallback := -1
+	if sourceHeight > 0 {
+		for i, r := range renditions {
+			if r.Height == 0 {
+				continue
+			}
+			if r.Height <= sourceHeight {
+				fallback = -1
+				break
+			}
+			if fallback < 0 || r.Height < renditions[fallback].Height {
+				fallback = i
+			}
+		}
+	}
+
+	var planned []Rendition
+	results := make([]RenditionResult, 0, len(renditions))
+	for i, r := range renditions {
+		result := RenditionResult{Rendition: r}
+		switch {
+		case r.Height > 0 && info.Video == nil:
+			result.Skipped, result.Reason = true, "源文件没有视频流"
+		case r.Height > 0 && sourceHeight > 0 && r.Height > sourceHeight && i != fallback:
+			result.Skipped, result.Reason = true, fmt.Sprintf("高于源分辨率 %dp", sourceHeight)
+		case r.Height == 0 && info.Audio == nil:
+			result.Skipped, result.Reason = true, "源文件没有音频流"
+		}
+		if result.Skipped {
+			results = append(results, result)
+			continue
+		}
+
+		if i == fallback {
+			r.Height = sourceHeight &^ 1
+		}
+		if info.Audio == nil {
+			r.AudioBitrate = 0
+		}
+		result.Rendition = r
+		planned = append(planned, r)
+		results = append(results, result)
+	}
+
+	if len(planned) == 0 {
+		return nil, nil, fmt.Errorf("码率阶梯中没有适用于该文件的档位")
+	}
+	return planned, results, nil
+}
+
+// LadderPlaylist 获取 HLS 码率阶梯中一档的子播放列表路径,其他格式返回空
+func LadderPlaylist(format *Format, outputPath string, r Rendition) string {
+	if format.Muxer != "hls" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(outputPath), r.Name+".m3u8")
+}
+
+// ladderArgs 构建码率阶梯的编码和封装参数,返回参数和 FFmpeg 的输出路径
+// 视频只解码一次,通过 split 滤镜分给各档位分别缩放、编码
+func (c *Converter) ladderArgs(outputPath string, format *Format, opts *ConvertOptions, accel gpu.AccelerationType, audioInput string) ([]string, string) {
+	level, ok := qualityLevels[opts.Quality]
+	if !ok {
+		level = qualityLevels[QualityMedium]
+	}
+
+	var videos []Rendition
+	for _, r := range opts.Renditions {
+		if r.Height > 0 {
+			videos = append(videos, r)
+		}
+	}
+
+	var args []string
+
+	// [0:v]split=3[s0][s1][s2];[s0]scale=-2:1080[v0];...
+	var graph strings.Builder
+	if len(videos) > 1 {
+		graph.WriteString(fmt.Sprintf("[0:v]split=%d", len(videos)))
+		for i := range videos {
+			graph.WriteString(fmt.Sprintf("[s%d]", i))
+		}
+		graph.WriteString(";")
+	}
+	for i, r := range videos {
+		in := fmt.Sprintf("[s%d]", i)
+		if len(videos) == 1 {
+			in = "[0:v]"
+		}
+		scaled := ConvertOptions{Resolution: fmt.Sprintf("%dp", r.Height)}
+		if i > 0 {
+			graph.WriteString(";")
+		}
+		graph.WriteString(fmt.Sprintf("%s%s[v%d]", in, scaled.scaleFilter(accel), i))
+	}
+	if len(videos) > 0 {
+		args = append(args, "-filter_complex", graph.String())
+	}
+
+	// 视频输出流,每档按码率编码
+	for i, r := range videos {
+		k := strconv.Itoa(i)
+		args = append(args, "-map", fmt.Sprintf("[v%d]", i))
+		if accel == gpu.AccelNone {
+			args = append(args, "-c:v:"+k, "libx264")
+		} else {
+			args = append(args, "-c:v:"+k, c.gpuConfig.EncodeCodec)
+		}
+		args = append(args, presetArgs(accel, level, ":v:"+k)...)
+		if accel == gpu.AccelAMD {
+			// 与限制码率的单路转换一致,AMF 使用峰值约束 VBR
+			args = append(args, "-rc:v:"+k, "vbr_peak")
+		}
+		args = append(args,
+			"-b:v:"+k, fmt.Sprintf("%dk", r.VideoBitrate),
+			"-maxrate:v:"+k, fmt.Sprintf("%dk", r.VideoBitrate*107/100),
+			"-bufsize:v:"+k, fmt.Sprintf("%dk", r.VideoBitrate*2),
+		)
+	}
+	if accel == gpu.AccelVideoToolbox {
+		args = append(args, "-realtime", "1", "-allow_sw", "1")
+	}
+	if opts.FPS > 0 {
+		args = append(args, "-r", strconv.FormatFloat(opts.FPS, 'f', -1, 64))
+	}
+	if opts.ConstantFrameRate {
+		args = append(args, "-fps_mode", "cfr")
+	}
+	args = append(args, "-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", segmentDuration))
+
+	// 音频输出流: HLS 每个变体带一路音频;DASH 中相同码率的音频只编码一次
+	audioIndex := make(map[int]int)
+	variantAudio := make([]int, len(opts.Renditions))
+	audioCount := 0
+	for i, r := range opts.Renditions {
+		variantAudio[i] = -1
+		if r.AudioBitrate == 0 {
+			continue
+		}
+		if j, ok := audioIndex[r.AudioBitrate]; ok && format.Muxer != "hls" {
+			variantAudio[i] = j
+			continue
+		}
+		j := strconv.Itoa(audioCount)
+		args = append(args, "-map", audioInput+":a:0",
+			"-c:a:"+j, format.AudioCodec, "-b:a:"+j, fmt.Sprintf("%dk", r.AudioBitrate))
+		audioIndex[r.AudioBitrate] = audioCount
+		variantAudio[i] = audioCount
+		audioCount++
+	}
+	if opts.AudioChannels > 0 {
+		args = append(args, "-ac", strconv.Itoa(opts.AudioChannels))
+	}
+	if opts.AudioSampleRate > 0 {
+		args = append(args, "-ar", strconv.Itoa(opts.AudioSampleRate))
+	}
+	if filter := opts.audioFilter(); filter != "" && audioCount > 0 {
+		args = append(args, "-af", filter)
+	}
+
+	args = append(args, "-f", format.Muxer)
+	args = append(args, format.MuxerArgs...)
+
+	if format.Muxer != "hls" {
+		sets := "id=0,streams=v"
+		if audioCount > 0 {
+			sets += " id=1,streams=a"
+		}
+		return append(args, "-adaptation_sets", sets), outputPath
+	}
+
+	// HLS: 每档一个子播放列表 {name}.m3u8,主播放列表为任务的输出路径
+	var variants []string
+	videoIndex := 0
+	for i, r := range opts.Renditions {
+		var streams []string
+		if r.Height > 0 {
+			streams = append(streams, fmt.Sprintf("v:%d", videoIndex))
+			videoIndex++
+		}
+		if variantAudio[i] >= 0 {
+			streams = append(streams, fmt.Sprintf("a:%d", variantAudio[i]))
+		}
+		variants = append(variants, strings.Join(append(streams, "name:"+r.Name), ","))
+	}
+
+	dir := filepath.Dir(outputPath)
+	args = append(args,
+		"-master_pl_name", filepath.Base(outputPath),
+		"-hls_segment_filename", filepath.Join(dir, "%v_%05d.ts"),
+		"-var_stream_map", strings.Join(variants, " "),
+	)
+	return args, filepath.Join(dir, "%v.m3u8")
+}
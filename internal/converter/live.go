@@ -0,0 +1,108 @@
+package converter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	"goalfy-mediaconverter/internal/ffmpeg"
+	"goalfy-mediaconverter/internal/progress"
+)
+
+// 实时转换的输出格式
+const (
+	LiveMP4 = "mp4" // 单个 MP4 文件,录制结束后写入 moov 索引
+	LiveHLS = "hls" // HLS event 播放列表,录制过程中即可边录边播
+)
+
+// IsValidLiveFormat 检查实时转换的输出格式是否有效
+func IsValidLiveFormat(format string) bool {
+	return format == LiveMP4 || format == LiveHLS
+}
+
+// LiveOutputPath 实时转换的输出路径,与同名输出格式的文件布局一致
+func LiveOutputPath(outputDir, taskID, format string) string {
+	return formats[format].OutputPath(outputDir, taskID)
+}
+
+// ConvertLive 将持续到达的录制数据实时转换为 MP4 或 HLS
+// FFmpeg 随数据到达逐步编码,input 返回 EOF 表示录制结束,此时只剩最后一小段需要处理
+// 输入时长未知,updates 中只报告已处理时长;结束时关闭通道
+func (c *Converter) ConvertLive(ctx context.Context, input io.Reader, outputPath, format string, updates chan<- progress.Progress) error {
+	defer close(updates)
+
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return fmt.Errorf("创建输出目录失败: %v", err)
+	}
+
+	// 实时编码必须跟上录制速度,固定使用 CPU 快速预设
+	// GPU 失败时已消费的输入无法重放,这里不使用硬件编码
+	log.Printf("📡 开始实时转换 (%s): %s", format, outputPath)
+
+	args := []string{
+		"-i", "pipe:0",
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "23",
+		"-c:a", "aac",
+	}
+	if format == LiveHLS {
+		args = append(args,
+			"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", segmentDuration),
+			"-f", "hls",
+			"-hls_time", strconv.Itoa(segmentDuration),
+			"-hls_playlist_type", "event",
+			"-hls_segment_filename", filepath.Join(filepath.Dir(outputPath), "segment_%05d.ts"),
+		)
+	} else {
+		args = append(args, "-f", "mp4", "-movflags", "+faststart")
+	}
+	args = append(args, progress.Args()...)
+	args = append(args, "-y", outputPath)
+
+	cmd := exec.CommandContext(ctx, c.ffmpegPath, args...)
+
+	// 不直接把 input 赋给 cmd.Stdin: 那样 FFmpeg 提前退出后 Wait 仍会阻塞到下一块数据到达
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("创建 stdin 管道失败: %v", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("创建 stdout 管道失败: %v", err)
+	}
+
+	// 只保留 stderr 末尾部分,用于失败时的错误信息
+	stderr := ffmpeg.NewTailBuffer()
+	cmd.Stderr = stderr
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("启动 FFmpeg 失败: %v", err)
+	}
+
+	go func() {
+		if _, err := io.Copy(stdin, input); err != nil {
+			// 输入中断(如上传被取消)时终止 FFmpeg,不把不完整的录制当作成功输出
+			cmd.Process.Kill()
+		}
+		stdin.Close()
+	}()
+
+	progress.Parse(stdout, 0, func(p progress.Progress) {
+		// 丢弃来不及消费的旧进度,避免阻塞 FFmpeg 输出
+		select {
+		case updates <- p:
+		default:
+		}
+	})
+
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("FFmpeg 实时转换失败: %v\nFFmpeg 输出:\n%s", err, stderr.String())
+	}
+
+	log.Printf("✅ 实时转换完成: %s", outputPath)
+	return nil
+}
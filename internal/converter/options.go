@@ -0,0 +1,358 @@
+package converter
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"goalfy-mediaconverter/internal/gpu"
+	"goalfy-mediaconverter/internal/thumbnail"
+)
+
+// 质量预设
+const (
+	QualityLow      = "low"      // 快速转换,文件较小
+	QualityMedium   = "medium"   // 平衡质量和速度
+	QualityHigh     = "high"     // 高质量,转换较慢
+	QualityLossless = "lossless" // 无损,仅 CPU 编码
+)
+
+// qualityLevel 各质量预设在不同编码器上的参数
+type qualityLevel struct {
+	x264Preset string // libx264 preset
+	crf        string // libx264 CRF
+	nvPreset   string // NVENC preset (p1-p7)
+	amfQuality string // AMF -quality (speed/balanced/quality)
+	qsvPreset  string // QSV preset
+	cq         string // NVENC -cq / AMF -qp / QSV -global_quality
+	vtQuality  string // VideoToolbox -q:v (1-100,越大越好)
+	vp9CRF     string // libvpx-vp9 CRF
+	vp9Speed   string // libvpx-vp9 -cpu-used
+}
+
+var qualityLevels = map[string]qualityLevel{
+	QualityLow:    {x264Preset: "veryfast", crf: "28", nvPreset: "p2", amfQuality: "speed", qsvPreset: "veryfast", cq: "30", vtQuality: "50", vp9CRF: "40", vp9Speed: "5"},
+	QualityMedium: {x264Preset: "medium", crf: "23", nvPreset: "p4", amfQuality: "balanced", qsvPreset: "medium", cq: "23", vtQuality: "65", vp9CRF: "33", vp9Speed: "3"},
+	QualityHigh:   {x264Preset: "slow", crf: "18", nvPreset: "p6", amfQuality: "quality", qsvPreset: "slow", cq: "19", vtQuality: "80", vp9CRF: "28", vp9Speed: "2"},
+}
+
+// 未指定分辨率/帧率时 GIF 的默认参数,避免生成过大的文件
+const (
+	gifDefaultWidth = 480
+	gifDefaultFPS   = 10
+)
+
+// maxAudioOffset 音频偏移的最大绝对值(秒)
+const maxAudioOffset = 10.0
+
+// maxCFRRate 按输入帧率推算恒定帧率时的上限,VFR 录制的标称帧率可能高达 1000
+const maxCFRRate = 60
+
+// validSampleRates 允许的音频采样率
+var validSampleRates = map[int]bool{
+	8000: true, 11025: true, 16000: true, 22050: true, 24000: true,
+	32000: true, 44100: true, 48000: true, 88200: true, 96000: true,
+}
+
+// ConvertOptions 转换选项
+type ConvertOptions struct {
+	Quality           string             `json:"quality,omitempty"`           // 质量预设 low/medium/high/lossless
+	Resolution        string             `json:"resolution,omitempty"`        // 目标分辨率,如 "1280x720" 或 "720p"(按高度等比缩放)
+	MaxBitrate        int                `json:"maxBitrate,omitempty"`        // 最大视频码率(kbps)
+	FPS               float64            `json:"fps,omitempty"`               // 输出帧率
+	AudioBitrate      int                `json:"audioBitrate,omitempty"`      // 音频码率(kbps)
+	AudioChannels     int                `json:"audioChannels,omitempty"`     // 音频声道数
+	AudioSampleRate   int                `json:"audioSampleRate,omitempty"`   // 音频采样率(Hz)
+	ConstantFrameRate bool               `json:"constantFrameRate,omitempty"` // 输出恒定帧率,未指定 fps 时按输入平均帧率取整
+	AudioSync         bool               `json:"audioSync,omitempty"`         // 重采样音频以跟随时间戳,修正长时间录制的音画漂移
+	AudioOffset       float64            `json:"audioOffset,omitempty"`       // 音频偏移(秒),正值延后音频,负值提前音频
+	Ladder            bool               `json:"ladder,omitempty"`            // 按配置中的码率阶梯一次输出多个档位,仅分段格式
+	Renditions        []Rendition        `json:"renditions,omitempty"`        // 自定义码率阶梯,覆盖配置中的阶梯
+	Thumbnails        *thumbnail.Options `json:"thumbnails,omitempty"`        // 转换完成后生成封面、缩略图和雪碧图
+}
+
+// DefaultOptions 默认转换选项
+func DefaultOptions() *ConvertOptions {
+	return &ConvertOptions{Quality: QualityMedium}
+}
+
+// Validate 校验并规范化选项,返回的错误信息可直接返回给客户端
+func (o *ConvertOptions) Validate() error {
+	if o.Quality == "" {
+		o.Quality = QualityMedium
+	}
+	if _, ok := qualityLevels[o.Quality]; !ok && o.Quality != QualityLossless {
+		return fmt.Errorf("无效的 quality: %s (可选 low/medium/high/lossless)", o.Quality)
+	}
+
+	if o.Resolution != "" {
+		if _, _, err := parseResolution(o.Resolution); err != nil {
+			return err
+		}
+	}
+
+	if o.MaxBitrate != 0 && (o.MaxBitrate < 100 || o.MaxBitrate > 200000) {
+		return fmt.Errorf("maxBitrate 超出范围: %d (100-200000 kbps)", o.MaxBitrate)
+	}
+	if o.FPS != 0 && (o.FPS < 1 || o.FPS > 120) {
+		return fmt.Errorf("fps 超出范围: %g (1-120)", o.FPS)
+	}
+	if o.AudioBitrate != 0 && (o.AudioBitrate < 32 || o.AudioBitrate > 512) {
+		return fmt.Errorf("audioBitrate 超出范围: %d (32-512 kbps)", o.AudioBitrate)
+	}
+	if o.AudioChannels != 0 && (o.AudioChannels < 1 || o.AudioChannels > 8) {
+		return fmt.Errorf("audioChannels 超出范围: %d (1-8)", o.AudioChannels)
+	}
+	if o.AudioSampleRate != 0 && !validSampleRates[o.AudioSampleRate] {
+		return fmt.Errorf("不支持的 audioSampleRate: %d", o.AudioSampleRate)
+	}
+	if !(math.Abs(o.AudioOffset) <= maxAudioOffset) {
+		return fmt.Errorf("audioOffset 超出范围: %g (-%g 到 %g 秒)", o.AudioOffset, maxAudioOffset, maxAudioOffset)
+	}
+	if len(o.Renditions) > 0 {
+		if err := ValidateLadder(o.Renditions); err != nil {
+			return err
+		}
+		o.Ladder = true
+	}
+	if o.Thumbnails != nil {
+		if err := o.Thumbnails.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseResolution 解析 "WxH" 或 "720p" 格式的分辨率,宽度为 -2 表示按比例自动计算
+func parseResolution(value string) (int, int, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+
+	if strings.HasSuffix(value, "p") {
+		height, err := strconv.Atoi(strings.TrimSuffix(value, "p"))
+		if err != nil || height < 16 || height > 4320 || height%2 != 0 {
+			return 0, 0, fmt.Errorf("无效的 resolution: %s", value)
+		}
+		return -2, height, nil
+	}
+
+	w, h, ok := strings.Cut(value, "x")
+	if !ok {
+		return 0, 0, fmt.Errorf("无效的 resolution: %s (格式为 1280x720 或 720p)", value)
+	}
+	width, errW := strconv.Atoi(w)
+	height, errH := strconv.Atoi(h)
+	if errW != nil || errH != nil || width < 16 || height < 16 || width > 7680 || height > 4320 {
+		return 0, 0, fmt.Errorf("无效的 resolution: %s", value)
+	}
+	if width%2 != 0 || height%2 != 0 {
+		return 0, 0, fmt.Errorf("resolution 的宽高必须为偶数: %s", value)
+	}
+	return width, height, nil
+}
+
+// gpuCompatible 选项和输出格式是否可以使用 GPU 编码
+// GPU 只用于 H.264 格式;硬件编码器不支持真正的无损模式,无损时固定使用 libx264
+func (o *ConvertOptions) gpuCompatible(format *Format) bool {
+	return format.GPU && o.Quality != QualityLossless
+}
+
+// videoArgs 根据输出格式和编码器生成视频编码参数
+// accel 为 gpu.AccelNone 时使用格式对应的 CPU 编码器
+func (o *ConvertOptions) videoArgs(cfg *gpu.Config, accel gpu.AccelerationType, format *Format) []string {
+	switch format.VideoCodec {
+	case "":
+		return []string{"-vn"}
+	case "gif":
+		return o.gifArgs()
+	}
+
+	level, ok := qualityLevels[o.Quality]
+	if !ok {
+		level = qualityLevels[QualityMedium]
+	}
+
+	var args []string
+	if filter := o.scaleFilter(accel); filter != "" {
+		args = append(args, "-vf", filter)
+	}
+	if o.FPS > 0 {
+		args = append(args, "-r", strconv.FormatFloat(o.FPS, 'f', -1, 64))
+	}
+	if o.ConstantFrameRate {
+		// 按输出帧率复制或丢弃帧,VFR 输入的时间戳被规整为等间隔
+		args = append(args, "-fps_mode", "cfr")
+	}
+
+	maxrate := fmt.Sprintf("%dk", o.MaxBitrate)
+	bufsize := fmt.Sprintf("%dk", o.MaxBitrate*2)
+
+	switch accel {
+	case gpu.AccelNVIDIA:
+		args = append(args, "-c:v", cfg.EncodeCodec)
+		args = append(args, presetArgs(accel, level, "")...)
+		args = append(args, "-cq", level.cq)
+		if o.MaxBitrate > 0 {
+			args = append(args, "-maxrate", maxrate, "-bufsize", bufsize)
+		}
+	case gpu.AccelAMD:
+		args = append(args, "-c:v", cfg.EncodeCodec)
+		args = append(args, presetArgs(accel, level, "")...)
+		if o.MaxBitrate > 0 {
+			// CQP 模式不受码率约束,限制码率时改用峰值约束 VBR
+			args = append(args, "-rc", "vbr_peak",
+				"-b:v", fmt.Sprintf("%dk", o.MaxBitrate*4/5), "-maxrate", maxrate)
+		} else {
+			args = append(args, "-rc", "cqp", "-qp_i", level.cq, "-qp_p", level.cq)
+		}
+	case gpu.AccelIntel:
+		args = append(args, "-c:v", cfg.EncodeCodec)
+		args = append(args, presetArgs(accel, level, "")...)
+		args = append(args, "-global_quality", level.cq)
+		if o.MaxBitrate > 0 {
+			args = append(args, "-maxrate", maxrate, "-bufsize", bufsize)
+		}
+	case gpu.AccelVideoToolbox:
+		args = append(args, "-c:v", cfg.EncodeCodec)
+		if o.MaxBitrate > 0 {
+			// VideoToolbox 的 -q:v 会忽略码率设置,限制码率时改用 ABR
+			args = append(args, "-b:v", maxrate, "-maxrate", maxrate, "-bufsize", bufsize)
+		} else {
+			args = append(args, "-b:v", "0", "-q:v", level.vtQuality)
+		}
+		args = append(args, "-realtime", "1", "-allow_sw", "1")
+	default:
+		if format.VideoCodec == "libvpx-vp9" {
+			return append(args, o.vp9Args(level)...)
+		}
+
+		args = append(args, "-c:v", "libx264")
+		if o.Quality == QualityLossless {
+			args = append(args, "-preset", "medium", "-qp", "0")
+		} else {
+			args = append(args, presetArgs(accel, level, "")...)
+			args = append(args, "-crf", level.crf)
+			if o.MaxBitrate > 0 {
+				args = append(args, "-maxrate", maxrate, "-bufsize", bufsize)
+			}
+		}
+	}
+
+	return args
+}
+
+// presetArgs 生成各编码器按质量预设的速度/质量档位参数,不涉及码率控制
+// stream 为流说明符后缀(如 ":v:0"),单路输出时为空;码率阶梯按各档码率编码时也使用同样的档位
+// VideoToolbox 没有速度档位,其 -q:v 会使码率设置失效,不在这里设置
+func presetArgs(accel gpu.AccelerationType, level qualityLevel, stream string) []string {
+	switch accel {
+	case gpu.AccelNone:
+		return []string{"-preset" + stream, level.x264Preset}
+	case gpu.AccelNVIDIA:
+		return []string{"-preset" + stream, level.nvPreset}
+	case gpu.AccelAMD:
+		return []string{"-quality" + stream, level.amfQuality}
+	case gpu.AccelIntel:
+		return []string{"-preset" + stream, level.qsvPreset}
+	}
+	return nil
+}
+
+// vp9Args 生成 libvpx-vp9 编码参数
+func (o *ConvertOptions) vp9Args(level qualityLevel) []string {
+	args := []string{"-c:v", "libvpx-vp9", "-row-mt", "1", "-deadline", "good"}
+
+	if o.Quality == QualityLossless {
+		return append(args, "-lossless", "1")
+	}
+
+	args = append(args, "-cpu-used", level.vp9Speed, "-crf", level.vp9CRF)
+	if o.MaxBitrate > 0 {
+		// 受约束质量模式: CRF 配合码率上限
+		return append(args, "-b:v", fmt.Sprintf("%dk", o.MaxBitrate))
+	}
+	return append(args, "-b:v", "0")
+}
+
+// gifArgs 生成 GIF 参数,使用调色板两步法保证画质
+func (o *ConvertOptions) gifArgs() []string {
+	fps := o.FPS
+	if fps <= 0 {
+		fps = gifDefaultFPS
+	}
+
+	scale := fmt.Sprintf("scale=%d:-1:flags=lanczos", gifDefaultWidth)
+	if o.Resolution != "" {
+		scale = o.scaleFilter(gpu.AccelNone) + ":flags=lanczos"
+	}
+
+	filter := fmt.Sprintf("fps=%s,%s,split[s0][s1];[s0]palettegen[p];[s1][p]paletteuse",
+		strconv.FormatFloat(fps, 'f', -1, 64), scale)
+	return []string{"-vf", filter, "-c:v", "gif", "-loop", "0"}
+}
+
+// scaleFilter 生成缩放滤镜
+// 硬件帧保留在显存中时需要使用对应的硬件缩放滤镜
+func (o *ConvertOptions) scaleFilter(accel gpu.AccelerationType) string {
+	if o.Resolution == "" {
+		return ""
+	}
+	width, height, err := parseResolution(o.Resolution)
+	if err != nil {
+		return ""
+	}
+
+	switch accel {
+	case gpu.AccelNVIDIA:
+		return fmt.Sprintf("scale_cuda=%d:%d", width, height)
+	case gpu.AccelVideoToolbox:
+		return fmt.Sprintf("scale_vt=%d:%d", width, height)
+	default:
+		return fmt.Sprintf("scale=%d:%d", width, height)
+	}
+}
+
+// audioArgs 根据输出格式生成音频编码参数
+func (o *ConvertOptions) audioArgs(format *Format) []string {
+	if format.AudioCodec == "" {
+		return []string{"-an"}
+	}
+
+	args := []string{"-c:a", format.AudioCodec}
+	if o.AudioBitrate > 0 {
+		args = append(args, "-b:a", fmt.Sprintf("%dk", o.AudioBitrate))
+	}
+	if o.AudioChannels > 0 {
+		args = append(args, "-ac", strconv.Itoa(o.AudioChannels))
+	}
+	if o.AudioSampleRate > 0 {
+		args = append(args, "-ar", strconv.Itoa(o.AudioSampleRate))
+	}
+	if filter := o.audioFilter(); filter != "" {
+		args = append(args, "-af", filter)
+	}
+	return args
+}
+
+// audioFilter 生成音画同步相关的音频滤镜
+// first_pts=0 让音频从 0 开始: 偏移后音频晚于视频时在开头补静音,早于视频时裁掉多出的部分
+func (o *ConvertOptions) audioFilter() string {
+	switch {
+	case o.AudioSync:
+		// 时间戳与采样数不一致时拉伸/压缩音频,超过 1000 个采样的差距直接补静音或丢弃
+		return "aresample=async=1000:first_pts=0"
+	case o.AudioOffset != 0:
+		return "aresample=first_pts=0"
+	default:
+		return ""
+	}
+}
+
+// cfrRate 根据输入的平均帧率推算恒定帧率
+// VFR 录制的平均帧率不是整数(如 29.87),取整后限制在 1-60 之间
+func cfrRate(avgFrameRate float64) float64 {
+	if avgFrameRate <= 0 {
+		return 30
+	}
+	return math.Min(math.Max(math.Round(avgFrameRate), 1), maxCFRRate)
+}
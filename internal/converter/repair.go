@@ -0,0 +1,150 @@
+package converter
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"goalfy-mediaconverter/internal/ffmpeg"
+)
+
+// EBML 元素 ID
+const (
+	ebmlHeaderID = 0x1A45DFA3
+	ebmlSegment  = 0x18538067
+)
+
+// webmCodecs WebM 封装允许的编码,其余编码需要使用 Matroska 封装
+var webmCodecs = map[string]bool{
+	"vp8": true, "vp9": true, "av1": true, "opus": true, "vorbis": true,
+}
+
+// RepairRecording 修复浏览器 MediaRecorder 录制的 WebM/Matroska 文件
+// 录制时浏览器无法回写时长和索引(Cues),导致无法拖动进度、无法估算转换进度
+// 通过流复制重新封装写入时长和索引,原地替换文件;文件无需修复时返回 false
+func (c *Converter) RepairRecording(ctx context.Context, path string) (bool, error) {
+	info, err := c.prober.Probe(ctx, path)
+	if err != nil {
+		return false, err
+	}
+	if !strings.Contains(info.Container, "matroska") && !strings.Contains(info.Container, "webm") {
+		return false, nil
+	}
+
+	unknownSize, err := hasUnknownSegmentSize(path)
+	if err != nil {
+		return false, err
+	}
+	if info.Duration > 0 && !unknownSize {
+		return false, nil
+	}
+
+	muxer := "webm"
+	for _, stream := range info.Streams {
+		if !webmCodecs[stream.Codec] {
+			muxer = "matroska"
+			break
+		}
+	}
+
+	log.Printf("🔧 修复录制文件的时长和索引: %s", filepath.Base(path))
+
+	// 写入同目录的临时文件,成功后再替换,失败时原文件保持不变
+	tempPath := path + ".repair"
+	cmd := exec.CommandContext(ctx, c.ffmpegPath,
+		"-hide_banner",
+		"-i", path,
+		"-map", "0",
+		"-c", "copy",
+		"-f", muxer,
+		"-y", tempPath,
+	)
+	stderr := ffmpeg.NewTailBuffer()
+	cmd.Stderr = stderr
+
+	if err := cmd.Run(); err != nil {
+		os.Remove(tempPath)
+		return false, fmt.Errorf("重新封装失败: %v\nFFmpeg 输出:\n%s", err, stderr.String())
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return false, fmt.Errorf("替换文件失败: %v", err)
+	}
+
+	if repaired, err := c.prober.Probe(ctx, path); err == nil {
+		log.Printf("✅ 录制文件修复完成: %s (时长 %.2f 秒)", filepath.Base(path), repaired.Duration)
+	}
+	return true, nil
+}
+
+// hasUnknownSegmentSize 检查 Matroska Segment 元素是否为未知大小
+// 边录制边写出的文件(MediaRecorder)无法回写 Segment 大小,也就没有时长和索引
+func hasUnknownSegmentSize(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("打开文件失败: %v", err)
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+
+	id, _, err := readEBMLVint(r, false)
+	if err != nil || id != ebmlHeaderID {
+		return false, nil
+	}
+	size, _, err := readEBMLVint(r, true)
+	if err != nil {
+		return false, nil
+	}
+	if _, err := r.Discard(int(size)); err != nil {
+		return false, nil
+	}
+
+	id, _, err = readEBMLVint(r, false)
+	if err != nil || id != ebmlSegment {
+		return false, nil
+	}
+	_, unknown, err := readEBMLVint(r, true)
+	if err != nil {
+		return false, nil
+	}
+	return unknown, nil
+}
+
+// readEBMLVint 读取一个 EBML 变长整数
+// 元素 ID 保留长度标记位,元素大小去掉标记位;大小的数据位全为 1 表示未知大小
+func readEBMLVint(r io.ByteReader, isSize bool) (uint64, bool, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, false, err
+	}
+
+	length := 1
+	for mask := byte(0x80); length <= 8 && first&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > 8 {
+		return 0, false, fmt.Errorf("无效的 EBML 变长整数")
+	}
+
+	value := uint64(first)
+	if isSize {
+		value &= uint64(0xFF >> length)
+	}
+	for i := 1; i < length; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, false, err
+		}
+		value = value<<8 | uint64(b)
+	}
+
+	unknown := isSize && value == 1<<(7*length)-1
+	return value, unknown, nil
+}
@@ -0,0 +1,50 @@
+package converter
+
+import (
+	"goalfy-mediaconverter/internal/probe"
+)
+
+// AVSync 一个文件中音频相对视频的时间差(秒)
+type AVSync struct {
+	StartOffset float64 `json:"startOffset"` // 音频起点减视频起点,正值表示音频开始得晚
+	Drift       float64 `json:"drift"`       // 音频终点减视频终点,正值表示音频结束得晚
+}
+
+// SyncReport 转换前后的音画同步测量结果
+type SyncReport struct {
+	Input       *AVSync `json:"input,omitempty"`       // 输入文件
+	Output      *AVSync `json:"output,omitempty"`      // 输出文件
+	AudioOffset float64 `json:"audioOffset,omitempty"` // 转换时应用的音频偏移(秒)
+}
+
+// MeasureSync 根据媒体信息测量音画时间差,缺少音频或视频流、或流时长未知时返回 nil
+func MeasureSync(info *probe.MediaInfo) *AVSync {
+	if info == nil || info.Video == nil || info.Audio == nil {
+		return nil
+	}
+	if info.Video.Duration <= 0 || info.Audio.Duration <= 0 {
+		return nil
+	}
+
+	videoEnd := info.Video.StartTime + info.Video.Duration
+	audioEnd := info.Audio.StartTime + info.Audio.Duration
+	return &AVSync{
+		StartOffset: info.Audio.StartTime - info.Video.StartTime,
+		Drift:       audioEnd - videoEnd,
+	}
+}
+
+// NewSyncReport 汇总转换前后的测量结果,两者都无法测量时返回 nil
+func NewSyncReport(input, output *probe.MediaInfo, opts *ConvertOptions) *SyncReport {
+	report := &SyncReport{
+		Input:  MeasureSync(input),
+		Output: MeasureSync(output),
+	}
+	if report.Input == nil && report.Output == nil {
+		return nil
+	}
+	if opts != nil {
+		report.AudioOffset = opts.AudioOffset
+	}
+	return report
+}
@@ -0,0 +1,63 @@
+// Package ffmpeg 提供转换器和缩略图生成器共用的 FFmpeg 执行辅助
+package ffmpeg
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+
+	"goalfy-mediaconverter/internal/progress"
+)
+
+// stderrTailLimit 失败时保留的 FFmpeg 输出长度
+const stderrTailLimit = 4096
+
+// TailBuffer 只保留最后一部分写入内容的缓冲区,用于失败时附带 FFmpeg 输出的末尾
+type TailBuffer struct {
+	buf   []byte
+	limit int
+}
+
+// NewTailBuffer 创建保留 FFmpeg 输出末尾的缓冲区
+func NewTailBuffer() *TailBuffer {
+	return &TailBuffer{limit: stderrTailLimit}
+}
+
+// Write 实现 io.Writer
+func (t *TailBuffer) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > t.limit {
+		t.buf = t.buf[len(t.buf)-t.limit:]
+	}
+	return len(p), nil
+}
+
+// String 返回缓冲内容
+func (t *TailBuffer) String() string {
+	return string(t.buf)
+}
+
+// RunWithProgress 执行 FFmpeg 并将 -progress 输出解析后交给 fn,阻塞直到 FFmpeg 退出
+// args 需包含 progress.Args();失败时错误中附带 stderr 的末尾部分
+func RunWithProgress(ctx context.Context, ffmpegPath string, args []string, duration float64, fn func(progress.Progress)) error {
+	cmd := exec.CommandContext(ctx, ffmpegPath, args...)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("创建 stdout 管道失败: %v", err)
+	}
+
+	stderr := NewTailBuffer()
+	cmd.Stderr = stderr
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("启动 FFmpeg 失败: %v", err)
+	}
+
+	progress.Parse(stdout, duration, fn)
+
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("%v\nFFmpeg 输出:\n%s", err, stderr.String())
+	}
+	return nil
+}
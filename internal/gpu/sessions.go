@@ -0,0 +1,55 @@
+package gpu
+
+import "context"
+
+// Sessions 硬件编码会话限制器
+// 转换器和切割器共享同一个限制器,两者同时运行时占用的会话总数也不超过编码器上限
+type Sessions struct {
+	slots chan struct{} // 已占用的会话,nil 表示不限制
+	turn  chan struct{} // 同一时刻只有一个调用方在占用会话
+}
+
+// NewSessions 创建会话限制器,limit 小于 1 时不限制
+func NewSessions(limit int) *Sessions {
+	if limit < 1 {
+		return &Sessions{}
+	}
+	return &Sessions{
+		slots: make(chan struct{}, limit),
+		turn:  make(chan struct{}, 1),
+	}
+}
+
+// Acquire 占用 n 个会话,ctx 取消时返回错误
+// 一个 FFmpeg 进程同时运行多路编码器(如码率阶梯)时 n 大于 1,超过上限时按上限占用
+func (s *Sessions) Acquire(ctx context.Context, n int) (release func(), err error) {
+	if s == nil || s.slots == nil {
+		return func() {}, nil
+	}
+	n = min(max(n, 1), cap(s.slots))
+
+	// 逐个占用会话时持有 turn,避免两个多路编码进程各占一部分后互相等待
+	select {
+	case s.turn <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-s.turn }()
+
+	for i := 0; i < n; i++ {
+		select {
+		case s.slots <- struct{}{}:
+		case <-ctx.Done():
+			s.release(i)
+			return nil, ctx.Err()
+		}
+	}
+	return func() { s.release(n) }, nil
+}
+
+// release 归还 n 个会话
+func (s *Sessions) release(n int) {
+	for i := 0; i < n; i++ {
+		<-s.slots
+	}
+}
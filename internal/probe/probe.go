@@ -0,0 +1,317 @@
+package probe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Stream 媒体流信息
+type Stream struct {
+	Index         int     `json:"index"`                   // 流索引
+	Type          string  `json:"type"`                    // 流类型 video/audio/subtitle/data
+	Codec         string  `json:"codec"`                   // 编码器名称
+	Profile       string  `json:"profile,omitempty"`       // 编码 profile
+	Level         int     `json:"level,omitempty"`         // 编码 level(H.264 的 31 表示 3.1)
+	BitRate       int64   `json:"bitRate,omitempty"`       // 码率(bps)
+	Duration      float64 `json:"duration,omitempty"`      // 时长(秒)
+	StartTime     float64 `json:"startTime"`               // 起始时间戳(秒)
+	Language      string  `json:"language,omitempty"`      // 语言标签
+	Width         int     `json:"width,omitempty"`         // 视频宽度
+	Height        int     `json:"height,omitempty"`        // 视频高度
+	FrameRate     float64 `json:"frameRate,omitempty"`     // 帧率
+	PixelFormat   string  `json:"pixelFormat,omitempty"`   // 像素格式
+	Rotation      int     `json:"rotation,omitempty"`      // 顺时针旋转角度 0/90/180/270
+	SampleRate    int     `json:"sampleRate,omitempty"`    // 音频采样率(Hz)
+	Channels      int     `json:"channels,omitempty"`      // 音频声道数
+	ChannelLayout string  `json:"channelLayout,omitempty"` // 音频声道布局
+}
+
+// Chapter 章节信息
+type Chapter struct {
+	ID    int64   `json:"id"`              // 章节ID
+	Start float64 `json:"start"`           // 开始时间(秒)
+	End   float64 `json:"end"`             // 结束时间(秒)
+	Title string  `json:"title,omitempty"` // 章节标题
+}
+
+// MediaInfo 媒体文件信息
+type MediaInfo struct {
+	Container string    `json:"container"`          // 封装格式
+	Duration  float64   `json:"duration"`           // 时长(秒),未知时为 0
+	Size      int64     `json:"size"`               // 文件大小(字节)
+	BitRate   int64     `json:"bitRate"`            // 总码率(bps)
+	Streams   []Stream  `json:"streams"`            // 所有流
+	Chapters  []Chapter `json:"chapters,omitempty"` // 章节
+	Video     *Stream   `json:"video,omitempty"`    // 第一个视频流
+	Audio     *Stream   `json:"audio,omitempty"`    // 第一个音频流
+}
+
+// Prober ffprobe 封装
+type Prober struct {
+	ffprobePath string
+}
+
+// New 创建 Prober,优先使用与 FFmpeg 同目录的 ffprobe
+func New(ffmpegPath string) *Prober {
+	return &Prober{ffprobePath: findFFprobe(ffmpegPath)}
+}
+
+// Path 获取 ffprobe 路径
+func (p *Prober) Path() string {
+	return p.ffprobePath
+}
+
+// findFFprobe 查找 ffprobe 可执行文件
+func findFFprobe(ffmpegPath string) string {
+	// 与 FFmpeg 同名替换,保留 .exe 等扩展名
+	name := strings.Replace(filepath.Base(ffmpegPath), "ffmpeg", "ffprobe", 1)
+
+	dir := ""
+	if strings.ContainsAny(ffmpegPath, `/\`) {
+		dir = filepath.Dir(ffmpegPath)
+	} else if resolved, err := exec.LookPath(ffmpegPath); ffmpegPath != "" && err == nil {
+		dir = filepath.Dir(resolved)
+	}
+
+	if dir != "" && name != filepath.Base(ffmpegPath) {
+		candidate := filepath.Join(dir, name)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+	}
+
+	if resolved, err := exec.LookPath("ffprobe"); err == nil {
+		return resolved
+	}
+	return "ffprobe"
+}
+
+// ffprobeOutput ffprobe -print_format json 的输出结构
+type ffprobeOutput struct {
+	Format struct {
+		FormatName string            `json:"format_name"`
+		Duration   string            `json:"duration"`
+		Size       string            `json:"size"`
+		BitRate    string            `json:"bit_rate"`
+		Tags       map[string]string `json:"tags"`
+	} `json:"format"`
+	Streams []struct {
+		Index         int               `json:"index"`
+		CodecType     string            `json:"codec_type"`
+		CodecName     string            `json:"codec_name"`
+		Profile       string            `json:"profile"`
+		Level         int               `json:"level"`
+		BitRate       string            `json:"bit_rate"`
+		Duration      string            `json:"duration"`
+		StartTime     string            `json:"start_time"`
+		Width         int               `json:"width"`
+		Height        int               `json:"height"`
+		AvgFrameRate  string            `json:"avg_frame_rate"`
+		RFrameRate    string            `json:"r_frame_rate"`
+		PixFmt        string            `json:"pix_fmt"`
+		SampleRate    string            `json:"sample_rate"`
+		Channels      int               `json:"channels"`
+		ChannelLayout string            `json:"channel_layout"`
+		Tags          map[string]string `json:"tags"`
+		SideDataList  []struct {
+			Rotation float64 `json:"rotation"`
+		} `json:"side_data_list"`
+	} `json:"streams"`
+	Chapters []struct {
+		ID        int64             `json:"id"`
+		StartTime string            `json:"start_time"`
+		EndTime   string            `json:"end_time"`
+		Tags      map[string]string `json:"tags"`
+	} `json:"chapters"`
+}
+
+// Probe 获取媒体文件信息
+func (p *Prober) Probe(ctx context.Context, path string) (*MediaInfo, error) {
+	cmd := exec.CommandContext(ctx, p.ffprobePath,
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		"-show_chapters",
+		path,
+	)
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("ffprobe 执行失败: %v: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("ffprobe 执行失败: %v", err)
+	}
+
+	var raw ffprobeOutput
+	if err := json.Unmarshal(output, &raw); err != nil {
+		return nil, fmt.Errorf("解析 ffprobe 输出失败: %v", err)
+	}
+
+	info := &MediaInfo{
+		Container: raw.Format.FormatName,
+		Duration:  parseFloat(raw.Format.Duration),
+		Size:      parseInt(raw.Format.Size),
+		BitRate:   parseInt(raw.Format.BitRate),
+		Streams:   make([]Stream, 0, len(raw.Streams)),
+	}
+
+	for _, s := range raw.Streams {
+		stream := Stream{
+			Index:         s.Index,
+			Type:          s.CodecType,
+			Codec:         s.CodecName,
+			Profile:       s.Profile,
+			BitRate:       parseInt(s.BitRate),
+			Duration:      parseFloat(s.Duration),
+			StartTime:     parseFloat(s.StartTime),
+			Language:      s.Tags["language"],
+			Width:         s.Width,
+			Height:        s.Height,
+			PixelFormat:   s.PixFmt,
+			SampleRate:    int(parseInt(s.SampleRate)),
+			Channels:      s.Channels,
+			ChannelLayout: s.ChannelLayout,
+		}
+
+		// Matroska/WebM 的流时长保存在 DURATION 标签中
+		if stream.Duration == 0 {
+			stream.Duration = parseTimestamp(s.Tags["DURATION"])
+		}
+
+		if s.CodecType == "video" {
+			stream.Level = max(s.Level, 0)
+			stream.FrameRate = parseRational(s.AvgFrameRate)
+			if stream.FrameRate == 0 {
+				stream.FrameRate = parseRational(s.RFrameRate)
+			}
+
+			// 旧版 FFmpeg 使用 rotate 标签,新版使用显示矩阵(逆时针角度)
+			if rotate, err := strconv.Atoi(s.Tags["rotate"]); err == nil {
+				stream.Rotation = normalizeRotation(float64(rotate))
+			}
+			for _, sd := range s.SideDataList {
+				if sd.Rotation != 0 {
+					stream.Rotation = normalizeRotation(-sd.Rotation)
+				}
+			}
+		}
+
+		info.Streams = append(info.Streams, stream)
+	}
+
+	for i := range info.Streams {
+		stream := &info.Streams[i]
+		if stream.Type == "video" && info.Video == nil {
+			info.Video = stream
+		}
+		if stream.Type == "audio" && info.Audio == nil {
+			info.Audio = stream
+		}
+	}
+
+	for _, c := range raw.Chapters {
+		info.Chapters = append(info.Chapters, Chapter{
+			ID:    c.ID,
+			Start: parseFloat(c.StartTime),
+			End:   parseFloat(c.EndTime),
+			Title: c.Tags["title"],
+		})
+	}
+
+	// 封装层没有时长时(如 MediaRecorder 生成的 WebM),退回使用流时长
+	if info.Duration == 0 {
+		for _, stream := range info.Streams {
+			info.Duration = math.Max(info.Duration, stream.Duration)
+		}
+	}
+
+	return info, nil
+}
+
+// parseFloat 解析浮点数,"N/A" 等无效值返回 0
+func parseFloat(value string) float64 {
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0
+	}
+	return v
+}
+
+// parseInt 解析整数,无效值返回 0
+func parseInt(value string) int64 {
+	v, _ := strconv.ParseInt(value, 10, 64)
+	return v
+}
+
+// parseRational 解析 "30000/1001" 形式的分数
+func parseRational(value string) float64 {
+	num, den, ok := strings.Cut(value, "/")
+	if !ok {
+		return parseFloat(value)
+	}
+	d := parseFloat(den)
+	if d == 0 {
+		return 0
+	}
+	return math.Round(parseFloat(num)/d*1000) / 1000
+}
+
+// parseTimestamp 解析 "HH:MM:SS.xxx" 形式的时间戳
+func parseTimestamp(value string) float64 {
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 {
+		return 0
+	}
+	return parseFloat(parts[0])*3600 + parseFloat(parts[1])*60 + parseFloat(parts[2])
+}
+
+// normalizeRotation 将角度规范到 0/90/180/270
+func normalizeRotation(degrees float64) int {
+	rotation := int(math.Round(degrees/90)) * 90 % 360
+	if rotation < 0 {
+		rotation += 360
+	}
+	return rotation
+}
+
+// Keyframes 获取第一个视频流所有关键帧的时间戳(秒,升序)
+// 只读取数据包标志,不解码,长视频也很快
+func (p *Prober) Keyframes(ctx context.Context, path string) ([]float64, error) {
+	cmd := exec.CommandContext(ctx, p.ffprobePath,
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-show_entries", "packet=pts_time,flags",
+		"-of", "csv=p=0",
+		path,
+	)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe 读取关键帧失败: %v", err)
+	}
+
+	var keyframes []float64
+	for _, line := range strings.Split(string(output), "\n") {
+		ptsTime, flags, ok := strings.Cut(strings.TrimSpace(line), ",")
+		if !ok || !strings.Contains(flags, "K") {
+			continue
+		}
+		if t, err := strconv.ParseFloat(ptsTime, 64); err == nil {
+			keyframes = append(keyframes, t)
+		}
+	}
+
+	if len(keyframes) == 0 {
+		return nil, fmt.Errorf("未找到关键帧")
+	}
+	sort.Float64s(keyframes)
+	return keyframes, nil
+}
@@ -0,0 +1,87 @@
+package progress
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Progress FFmpeg 编码进度快照
+type Progress struct {
+	Percent  float64 `json:"percent"`  // 完成百分比 0-100(时长未知时为 0)
+	OutTime  float64 `json:"outTime"`  // 已处理的媒体时长(秒)
+	Duration float64 `json:"duration"` // 媒体总时长(秒),未知时为 0
+	Frame    int64   `json:"frame"`    // 已编码帧数
+	FPS      float64 `json:"fps"`      // 当前编码帧率
+	Speed    float64 `json:"speed"`    // 编码速度倍数(相对实时)
+	ETA      float64 `json:"eta"`      // 预计剩余时间(秒),未知时为 -1
+	Done     bool    `json:"done"`     // FFmpeg 是否已报告结束
+}
+
+// Args 返回让 FFmpeg 将机器可读进度写入 stdout 的参数
+// 需放在输出文件之前
+func Args() []string {
+	return []string{"-progress", "pipe:1", "-nostats"}
+}
+
+// Parse 解析 FFmpeg -progress 输出的 key=value 块
+// 每遇到一个 progress=continue/end 行调用一次 fn,直到 r 读完
+func Parse(r io.Reader, duration float64, fn func(Progress)) {
+	scanner := bufio.NewScanner(r)
+	current := Progress{Duration: duration, ETA: -1}
+
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "frame":
+			if v, err := strconv.ParseInt(value, 10, 64); err == nil {
+				current.Frame = v
+			}
+		case "fps":
+			if v, err := strconv.ParseFloat(value, 64); err == nil {
+				current.FPS = v
+			}
+		case "out_time_us", "out_time_ms":
+			// 两者单位实际上都是微秒(FFmpeg 历史遗留问题)
+			if v, err := strconv.ParseInt(value, 10, 64); err == nil && v >= 0 {
+				current.OutTime = float64(v) / 1e6
+			}
+		case "speed":
+			if v, err := strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64); err == nil {
+				current.Speed = v
+			}
+		case "progress":
+			current.Done = value == "end"
+			fn(current.finalize())
+		}
+	}
+}
+
+// finalize 根据已处理时长计算百分比和剩余时间
+func (p Progress) finalize() Progress {
+	if p.Duration > 0 {
+		p.Percent = p.OutTime / p.Duration * 100
+		if p.Percent > 100 {
+			p.Percent = 100
+		}
+		if p.Speed > 0 {
+			p.ETA = (p.Duration - p.OutTime) / p.Speed
+			if p.ETA < 0 {
+				p.ETA = 0
+			}
+		}
+	}
+	if p.Done {
+		if p.Duration > 0 {
+			p.Percent = 100
+		}
+		p.ETA = 0
+	}
+	return p
+}
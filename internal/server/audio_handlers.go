@@ -0,0 +1,138 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"goalfy-mediaconverter/internal/converter"
+	"goalfy-mediaconverter/internal/progress"
+	"goalfy-mediaconverter/internal/task"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleAudioStart 处理音频提取请求
+// POST /api/audio/start
+// 同步探测输入文件,没有音频流或 track 超出范围时直接返回 400
+func (s *Server) handleAudioStart(c *gin.Context) {
+	var req struct {
+		UploadID string `json:"uploadId"`
+		FilePath string `json:"filePath"`
+		TaskID   string `json:"taskId"`
+		Priority int    `json:"priority"`
+		converter.AudioOptions
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "请求参数错误",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	if err := req.AudioOptions.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	inputPath, ok := s.resolveInputPath(c, req.UploadID, req.FilePath, req.TaskID, "提取音频")
+	if !ok {
+		return
+	}
+
+	info, err := s.prober.Probe(c.Request.Context(), inputPath)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"success": false,
+			"message": "无法读取媒体信息",
+			"error":   err.Error(),
+		})
+		return
+	}
+	if err := req.AudioOptions.CheckAudio(info); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	format, _ := converter.LookupFormat(req.Format)
+	outputPath := format.OutputPath(s.config.OutputDir, generateTaskID())
+
+	audioTask := s.taskMgr.CreateAudio(inputPath, outputPath, req.AudioOptions.Format, req.UploadID, req.TaskID, req.AudioOptions)
+	s.enqueueAudioTask(audioTask, req.Priority)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "音频提取任务已加入队列",
+		"data": gin.H{
+			"taskId":        audioTask.ID,
+			"inputPath":     inputPath,
+			"outputPath":    outputPath,
+			"audio":         req.AudioOptions,
+			"status":        audioTask.Status,
+			"queuePosition": audioTask.QueuePosition,
+		},
+	})
+}
+
+// enqueueAudioTask 将音频提取任务加入队列,音频编码只占用 CPU 工作槽
+func (s *Server) enqueueAudioTask(t *task.Task, priority int) {
+	s.queue.Submit(task.Job{
+		Task:     t,
+		Class:    task.ClassCPU,
+		Priority: priority,
+		Run:      s.processAudioTask,
+	})
+}
+
+// processAudioTask 执行音频提取任务,阻塞直到提取结束
+func (s *Server) processAudioTask(t *task.Task) {
+	opts, err := task.Decode[converter.AudioOptions](t.Audio)
+	if err == nil && opts == nil {
+		err = fmt.Errorf("任务缺少音频提取参数")
+	}
+	if err != nil {
+		s.taskMgr.UpdateError(t.ID, fmt.Errorf("解析音频提取参数失败: %v", err))
+		return
+	}
+
+	s.taskMgr.UpdateStatus(t.ID, task.StatusProcessing, 0)
+
+	updates := make(chan progress.Progress, 10)
+	// 探测输出、标记完成后关闭,之后才释放工作槽
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		err := s.converter.ExtractAudio(t.Context(), t.InputPath, t.OutputPath, opts, updates)
+		if err != nil {
+			log.Printf("音频任务 %s 失败: %v", t.ID, err)
+			s.taskMgr.UpdateError(t.ID, err)
+			return
+		}
+
+		// 记录输出文件的媒体信息,探测失败不影响任务结果
+		if info, err := s.prober.Probe(t.Context(), t.OutputPath); err == nil {
+			s.taskMgr.SetMediaInfo(t.ID, info)
+		} else {
+			log.Printf("⚠️  获取任务 %s 输出媒体信息失败: %v", t.ID, err)
+		}
+
+		s.taskMgr.MarkCompleted(t.ID)
+		log.Printf("音频任务 %s 完成", t.ID)
+	}()
+
+	for p := range updates {
+		s.taskMgr.UpdateProgress(t.ID, encodeProgress(p))
+	}
+	<-done
+}
@@ -3,14 +3,19 @@ package server
 import (
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
+	"goalfy-mediaconverter/internal/converter"
+	"goalfy-mediaconverter/internal/progress"
 	"goalfy-mediaconverter/internal/task"
+	"goalfy-mediaconverter/internal/thumbnail"
 	"goalfy-mediaconverter/internal/upload"
 
 	"github.com/gin-gonic/gin"
@@ -23,18 +28,34 @@ import (
 func (s *Server) handleUploadInit(c *gin.Context) {
 	var req struct {
 		FileName    string `json:"fileName" binding:"required"`
-		FileSize    int64  `json:"fileSize" binding:"required"`
-		TotalChunks int    `json:"totalChunks" binding:"required"`
+		FileSize    int64  `json:"fileSize"`
+		TotalChunks int    `json:"totalChunks"`
 		ChunkSize   int64  `json:"chunkSize"`
+		Live        bool   `json:"live"`       // 边录制边上传,切片到达即送入 FFmpeg 转换
+		LiveFormat  string `json:"liveFormat"` // 实时转换的输出格式 mp4/hls
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
+	// 实时接收时录制尚未结束,文件大小和切片数在结束时才知道
+	if err := c.ShouldBindJSON(&req); err != nil || (!req.Live && (req.FileSize == 0 || req.TotalChunks == 0)) {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"message": "缺少必要参数: fileName, fileSize, totalChunks",
 		})
 		return
 	}
+	if req.Live {
+		if req.LiveFormat == "" {
+			req.LiveFormat = converter.LiveMP4
+		}
+		if !converter.IsValidLiveFormat(req.LiveFormat) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("不支持的 liveFormat: %s (可选 mp4/hls)", req.LiveFormat),
+			})
+			return
+		}
+		req.FileSize, req.TotalChunks = 0, 0
+	}
 
 	uploadTask, err := s.uploadMgr.CreateUploadTask(req.FileName, req.FileSize, req.TotalChunks, req.ChunkSize)
 	if err != nil {
@@ -47,14 +68,33 @@ func (s *Server) handleUploadInit(c *gin.Context) {
 		return
 	}
 
+	data := gin.H{
+		"uploadId":    uploadTask.UploadID,
+		"fileName":    uploadTask.FileName,
+		"totalChunks": uploadTask.TotalChunks,
+	}
+
+	if req.Live {
+		liveTask, err := s.startLiveIngest(uploadTask, req.LiveFormat)
+		if err != nil {
+			log.Printf("启动实时接收失败: %v", err)
+			s.uploadMgr.CancelUpload(uploadTask.UploadID)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": "启动实时接收失败",
+				"error":   err.Error(),
+			})
+			return
+		}
+		data["live"] = true
+		data["taskId"] = liveTask.ID
+		data["outputPath"] = liveTask.OutputPath
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "上传任务初始化成功",
-		"data": gin.H{
-			"uploadId":    uploadTask.UploadID,
-			"fileName":    uploadTask.FileName,
-			"totalChunks": uploadTask.TotalChunks,
-		},
+		"data":    data,
 	})
 }
 
@@ -139,7 +179,7 @@ func (s *Server) handleUploadChunk(c *gin.Context) {
 		},
 	})
 
-	// 如果所有切片都已上传,开始合并
+	// 如果所有切片都已上传,开始合并(实时接收的切片已在接收时写入,IsComplete 始终为 false)
 	if isComplete {
 		log.Printf("所有切片上传完成,开始合并文件: %s", uploadID)
 		go func() {
@@ -166,9 +206,15 @@ func (s *Server) handleUploadStatus(c *gin.Context) {
 		return
 	}
 
+	// 附带缺失的切片索引,客户端可据此在服务重启后继续上传
+	missingChunks, _ := s.uploadMgr.MissingChunks(uploadID)
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"data":    uploadTask,
+		"data": struct {
+			*upload.UploadTask
+			MissingChunks []int `json:"missingChunks"`
+		}{uploadTask, missingChunks},
 	})
 }
 
@@ -198,21 +244,39 @@ func (s *Server) handleUploadCancel(c *gin.Context) {
 // POST /api/convert/start
 func (s *Server) handleConvertStart(c *gin.Context) {
 	var req struct {
-		UploadID     string                 `json:"uploadId"`
-		FilePath     string                 `json:"filePath"`
-		OutputFormat string                 `json:"outputFormat"`
-		Quality      string                 `json:"quality"`
-		Options      map[string]interface{} `json:"options"`
+		UploadID     string                    `json:"uploadId"`
+		FilePath     string                    `json:"filePath"`
+		OutputFormat string                    `json:"outputFormat"`
+		Quality      string                    `json:"quality"`
+		Priority     int                       `json:"priority"`
+		Options      *converter.ConvertOptions `json:"options"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"message": "请求参数错误",
+			"error":   err.Error(),
 		})
 		return
 	}
 
+	// 校验转换选项,顶层 quality 优先于 options.quality
+	if req.Options == nil {
+		req.Options = converter.DefaultOptions()
+	}
+	if req.Quality != "" {
+		req.Options.Quality = req.Quality
+	}
+	if err := req.Options.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	req.Quality = req.Options.Quality
+
 	// 验证输入源
 	if req.UploadID == "" && req.FilePath == "" {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -260,27 +324,58 @@ func (s *Server) handleConvertStart(c *gin.Context) {
 	if req.OutputFormat == "" {
 		req.OutputFormat = "mp4"
 	}
-	if req.Quality == "" {
-		req.Quality = "medium"
+	format, ok := converter.LookupFormat(req.OutputFormat)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("不支持的输出格式: %s (可选 %s)", req.OutputFormat, strings.Join(converter.FormatNames(), "/")),
+		})
+		return
 	}
+	req.OutputFormat = format.Name
 
-	// 生成输出文件路径
-	outputPath := filepath.Join(s.config.OutputDir, fmt.Sprintf("%s.%s", generateTaskID(), req.OutputFormat))
+	// 码率阶梯一次输出多个档位,只能使用分段格式;未自定义时使用配置中的阶梯
+	if req.Options.Ladder {
+		if !format.Segmented() {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("码率阶梯只支持分段格式 (hls/dash/cmaf),当前格式: %s", format.Name),
+			})
+			return
+		}
+		if len(req.Options.Renditions) == 0 {
+			req.Options.Renditions = append([]converter.Rendition{}, s.ladder...)
+		}
+	}
+
+	if req.Options.Thumbnails != nil && format.AudioOnly() {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("纯音频格式(%s)不支持生成缩略图", format.Name),
+		})
+		return
+	}
+
+	// 生成输出文件路径,分段格式输出到以任务ID命名的目录
+	outputPath := format.OutputPath(s.config.OutputDir, generateTaskID())
 
 	// 创建转换任务
-	convertTask := s.taskMgr.CreateWithOptions(inputPath, outputPath, req.OutputFormat, req.Quality, req.UploadID)
+	convertTask := s.taskMgr.CreateWithOptions(inputPath, outputPath, req.OutputFormat, req.UploadID, req.Options.Quality, req.Options)
 
-	// 异步执行转换
-	go s.processConvertTask(convertTask)
+	// 加入队列,有空闲工作槽时执行
+	s.enqueueConvertTask(convertTask, req.Priority)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"message": "转换任务已启动",
+		"message": "转换任务已加入队列",
 		"data": gin.H{
-			"taskId":       convertTask.ID,
-			"inputPath":    inputPath,
-			"outputFormat": req.OutputFormat,
-			"quality":      req.Quality,
+			"taskId":        convertTask.ID,
+			"inputPath":     inputPath,
+			"outputFormat":  req.OutputFormat,
+			"quality":       req.Quality,
+			"options":       req.Options,
+			"status":        convertTask.Status,
+			"queuePosition": convertTask.QueuePosition,
 		},
 	})
 }
@@ -378,6 +473,14 @@ func (s *Server) handleConvertDownload(c *gin.Context) {
 		return
 	}
 
+	if convertTask.TrashedPath != "" {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "输出文件已移入回收站,可通过 POST /api/convert/restore/" + taskID + " 恢复",
+		})
+		return
+	}
+
 	if _, err := os.Stat(convertTask.OutputPath); os.IsNotExist(err) {
 		c.JSON(http.StatusNotFound, gin.H{
 			"success": false,
@@ -386,9 +489,15 @@ func (s *Server) handleConvertDownload(c *gin.Context) {
 		return
 	}
 
+	// 分段格式的分片按相对路径加载,重定向到静态文件服务中的播放列表
+	if taskFormat(convertTask).Segmented() {
+		c.Redirect(http.StatusFound, s.downloadURL(convertTask.OutputPath))
+		return
+	}
+
 	// 设置响应头
 	fileName := filepath.Base(convertTask.OutputPath)
-	c.Header("Content-Type", "video/mp4")
+	c.Header("Content-Type", converter.MIMETypeFor(convertTask.OutputPath))
 	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fileName))
 
 	// 流式传输文件
@@ -430,6 +539,7 @@ func (s *Server) handleProgress(c *gin.Context) {
 				"totalChunks":    uploadTask.TotalChunks,
 				"fileName":       uploadTask.FileName,
 				"fileSize":       uploadTask.FileSize,
+				"repaired":       uploadTask.Repaired,
 				"createdAt":      uploadTask.CreatedAt,
 				"updatedAt":      uploadTask.UpdatedAt,
 			},
@@ -439,8 +549,8 @@ func (s *Server) handleProgress(c *gin.Context) {
 
 	// 尝试作为转换任务查询
 	if convertTask, err := s.taskMgr.Get(id); err == nil {
-		// 如果任务状态为 completed,删除 inputPath 文件
-		if convertTask.Status == task.StatusCompleted && convertTask.InputPath != "" {
+		// 如果转换任务状态为 completed,删除 inputPath 文件
+		if convertTask.Type == task.TypeConvert && convertTask.Status == task.StatusCompleted && convertTask.InputPath != "" {
 			if _, err := os.Stat(convertTask.InputPath); err == nil {
 				// 文件存在,尝试删除
 				if err := os.Remove(convertTask.InputPath); err != nil {
@@ -451,21 +561,75 @@ func (s *Server) handleProgress(c *gin.Context) {
 			}
 		}
 
+		if convertTask.Type == task.TypeSplit {
+			c.JSON(http.StatusOK, gin.H{
+				"success": true,
+				"data": gin.H{
+					"type":            "split",
+					"taskId":          id,
+					"sourceTaskId":    convertTask.SourceTaskID,
+					"status":          convertTask.Status,
+					"progress":        convertTask.Progress,
+					"segmentProgress": convertTask.SegmentProgress,
+					"segments":        convertTask.Segments,
+					"outputPath":      convertTask.OutputPath,
+					"queuePosition":   convertTask.QueuePosition,
+					"error":           convertTask.Error,
+					"createdAt":       convertTask.CreatedAt,
+					"updatedAt":       convertTask.UpdatedAt,
+					"completedAt":     convertTask.CompletedAt,
+				},
+			})
+			return
+		}
+
+		if convertTask.Type == task.TypeThumbnail {
+			c.JSON(http.StatusOK, gin.H{
+				"success": true,
+				"data": gin.H{
+					"type":          "thumbnail",
+					"taskId":        id,
+					"sourceTaskId":  convertTask.SourceTaskID,
+					"status":        convertTask.Status,
+					"progress":      convertTask.Progress,
+					"inputPath":     convertTask.InputPath,
+					"thumbnails":    convertTask.Thumbnails,
+					"queuePosition": convertTask.QueuePosition,
+					"error":         convertTask.Error,
+					"createdAt":     convertTask.CreatedAt,
+					"updatedAt":     convertTask.UpdatedAt,
+					"completedAt":   convertTask.CompletedAt,
+				},
+			})
+			return
+		}
+
 		c.JSON(http.StatusOK, gin.H{
 			"success": true,
 			"data": gin.H{
-				"type":         "convert",
-				"taskId":       id,
-				"status":       convertTask.Status,
-				"progress":     convertTask.Progress,
-				"inputPath":    convertTask.InputPath,
-				"outputPath":   convertTask.OutputPath,
-				"outputFormat": convertTask.OutputFormat,
-				"quality":      convertTask.Quality,
-				"error":        convertTask.Error,
-				"createdAt":    convertTask.CreatedAt,
-				"updatedAt":    convertTask.UpdatedAt,
-				"completedAt":  convertTask.CompletedAt,
+				"type":          convertTask.Type,
+				"taskId":        id,
+				"status":        convertTask.Status,
+				"progress":      convertTask.Progress,
+				"duration":      convertTask.Duration,
+				"processedTime": convertTask.ProcessedTime,
+				"fps":           convertTask.FPS,
+				"speed":         convertTask.Speed,
+				"eta":           convertTask.ETA,
+				"inputPath":     convertTask.InputPath,
+				"outputPath":    convertTask.OutputPath,
+				"outputFormat":  convertTask.OutputFormat,
+				"outputs":       convertTask.Outputs,
+				"renditions":    convertTask.Renditions,
+				"thumbnails":    convertTask.Thumbnails,
+				"quality":       convertTask.Quality,
+				"queuePosition": convertTask.QueuePosition,
+				"trashedAt":     convertTask.TrashedAt,
+				"sync":          convertTask.Sync,
+				"error":         convertTask.Error,
+				"createdAt":     convertTask.CreatedAt,
+				"updatedAt":     convertTask.UpdatedAt,
+				"completedAt":   convertTask.CompletedAt,
 			},
 		})
 		return
@@ -480,23 +644,113 @@ func (s *Server) handleProgress(c *gin.Context) {
 
 // ==================== 辅助函数 ====================
 
-// processConvertTask 处理转换任务
+// enqueueConvertTask 将转换任务加入队列
+// 根据转换器是否启用 GPU 决定占用哪类工作槽
+func (s *Server) enqueueConvertTask(t *task.Task, priority int) {
+	class := task.ClassCPU
+	if s.converter.UsesGPU(taskFormat(t), taskOptions(t)) {
+		class = task.ClassGPU
+	}
+
+	s.queue.Submit(task.Job{
+		Task:     t,
+		Class:    class,
+		Priority: priority,
+		Run:      s.processConvertTask,
+	})
+}
+
+// processConvertTask 处理转换任务,阻塞直到转换结束
 func (s *Server) processConvertTask(t *task.Task) {
 	// 更新状态为处理中
 	s.taskMgr.UpdateStatus(t.ID, task.StatusProcessing, 0)
 
 	// 进度通道
-	progress := make(chan int, 10)
+	updates := make(chan progress.Progress, 10)
+
+	// 转换结束、后处理(探测、缩略图)完成后关闭,之后才释放工作槽
+	done := make(chan struct{})
 
 	// 启动转换
 	go func() {
-		err := s.converter.ConvertFile(t.Context(), t.InputPath, t.OutputPath, progress)
+		defer close(done)
+
+		options := taskOptions(t)
+
+		// 转换完成后可能删除输入文件,先测量输入的音画时间差
+		inputInfo, _ := s.prober.Probe(t.Context(), t.InputPath)
+
+		// 纯音频格式要求输入有音频流,避免返回难以理解的 FFmpeg 错误
+		if inputInfo != nil && inputInfo.Audio == nil && taskFormat(t).AudioOnly() {
+			close(updates)
+			s.taskMgr.UpdateError(t.ID, converter.ErrNoAudio)
+			return
+		}
+
+		// 码率阶梯按源文件去掉放大的档位和不存在的流
+		opts := options
+		var renditions []converter.RenditionResult
+		if len(opts.Renditions) > 0 && taskFormat(t).Segmented() {
+			planned, results, err := converter.PlanLadder(inputInfo, opts.Renditions)
+			if err != nil {
+				close(updates)
+				s.taskMgr.UpdateError(t.ID, err)
+				return
+			}
+			ladder := *opts
+			ladder.Renditions = planned
+			opts = &ladder
+			renditions = results
+		}
+
+		err := s.converter.ConvertFile(t.Context(), t.InputPath, t.OutputPath, taskFormat(t), opts, updates)
 		if err != nil {
 			log.Printf("任务 %s 转换失败: %v", t.ID, err)
 			s.taskMgr.UpdateError(t.ID, err)
 			return
 		}
 
+		// 记录输出文件的媒体信息,探测失败不影响任务结果
+		info, err := s.prober.Probe(t.Context(), t.OutputPath)
+		if err == nil {
+			s.taskMgr.SetMediaInfo(t.ID, info)
+		} else {
+			log.Printf("⚠️  获取任务 %s 输出媒体信息失败: %v", t.ID, err)
+		}
+		if report := converter.NewSyncReport(inputInfo, info, options); report != nil {
+			s.taskMgr.SetSync(t.ID, report)
+		}
+		if taskFormat(t).Segmented() {
+			s.taskMgr.SetOutputs(t.ID, s.collectOutputs(t.OutputPath))
+		}
+		if renditions != nil {
+			for i := range renditions {
+				if renditions[i].Skipped {
+					continue
+				}
+				if playlist := converter.LadderPlaylist(taskFormat(t), t.OutputPath, renditions[i].Rendition); playlist != "" {
+					renditions[i].Playlist = playlist
+					renditions[i].URL = s.downloadURL(playlist)
+				}
+			}
+			s.taskMgr.SetRenditions(t.ID, renditions)
+		}
+
+		// 生成缩略图,失败时只记录错误,不影响转换结果
+		// 分段格式的输出由多个分片组成,从输入文件截图
+		if options.Thumbnails != nil {
+			source := t.OutputPath
+			if taskFormat(t).Segmented() {
+				source = t.InputPath
+			}
+			result, err := s.generateThumbnails(t, source, *options.Thumbnails, nil)
+			if err != nil {
+				log.Printf("⚠️  任务 %s 生成缩略图失败: %v", t.ID, err)
+				result = &thumbnail.Result{Error: err.Error()}
+			}
+			s.taskMgr.SetThumbnails(t.ID, result)
+		}
+
 		// 转换完成
 		s.taskMgr.MarkCompleted(t.ID)
 		log.Printf("任务 %s 转换完成", t.ID)
@@ -508,13 +762,114 @@ func (s *Server) processConvertTask(t *task.Task) {
 	}()
 
 	// 更新进度
-	currentProgress := 0
-	for p := range progress {
-		currentProgress += p
-		if currentProgress > 100 {
-			currentProgress = 100
+	for p := range updates {
+		s.taskMgr.UpdateProgress(t.ID, encodeProgress(p))
+	}
+	<-done
+}
+
+// resolveInputPath 按 uploadId / filePath / taskId 确定任务的输入文件
+// taskId 指向已完成的转换任务,使用其输出文件;action 用于错误信息
+// 无法确定时已写入错误响应,返回 false
+func (s *Server) resolveInputPath(c *gin.Context, uploadID, filePath, taskID, action string) (string, bool) {
+	var inputPath string
+	switch {
+	case taskID != "":
+		sourceTask, err := s.taskMgr.Get(taskID)
+		if err != nil || sourceTask.Type != task.TypeConvert {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": "转换任务不存在",
+			})
+			return "", false
+		}
+		if sourceTask.Status != task.StatusCompleted {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("任务尚未完成,当前状态: %s", sourceTask.Status),
+			})
+			return "", false
 		}
-		s.taskMgr.UpdateStatus(t.ID, task.StatusProcessing, currentProgress)
+		if taskFormat(sourceTask).Segmented() {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("分段格式(%s)的输出不支持%s", sourceTask.OutputFormat, action),
+			})
+			return "", false
+		}
+		inputPath = sourceTask.OutputPath
+
+	case uploadID != "":
+		uploadTask, err := s.uploadMgr.GetUploadTask(uploadID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": "上传任务不存在",
+			})
+			return "", false
+		}
+		if uploadTask.Status != upload.UploadStatusMerged {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": fmt.Sprintf("文件尚未合并完成,当前状态: %s", uploadTask.Status),
+			})
+			return "", false
+		}
+		inputPath = uploadTask.MergedPath
+
+	case filePath != "":
+		inputPath = filePath
+
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "必须提供uploadId、filePath或taskId",
+		})
+		return "", false
+	}
+
+	// 检查输入文件是否存在
+	if _, err := os.Stat(inputPath); os.IsNotExist(err) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "输入文件不存在",
+		})
+		return "", false
+	}
+	return inputPath, true
+}
+
+// taskFormat 获取任务的输出格式,未知格式(旧版本记录)按 mp4 处理
+func taskFormat(t *task.Task) *converter.Format {
+	if format, ok := converter.LookupFormat(t.OutputFormat); ok {
+		return format
+	}
+	format, _ := converter.LookupFormat("mp4")
+	return format
+}
+
+// taskOptions 解析转换任务保存的转换选项
+// 没有保存选项的旧任务记录按任务质量使用默认选项
+func taskOptions(t *task.Task) *converter.ConvertOptions {
+	opts, err := task.Decode[converter.ConvertOptions](t.Options)
+	if err != nil {
+		log.Printf("⚠️  解析任务 %s 的转换选项失败: %v", t.ID, err)
+	}
+	if opts == nil {
+		return &converter.ConvertOptions{Quality: t.Quality}
+	}
+	return opts
+}
+
+// encodeProgress 将 FFmpeg 进度转换为任务进度
+func encodeProgress(p progress.Progress) task.EncodeProgress {
+	return task.EncodeProgress{
+		Percent:  p.Percent,
+		Duration: p.Duration,
+		OutTime:  p.OutTime,
+		FPS:      p.FPS,
+		Speed:    p.Speed,
+		ETA:      p.ETA,
 	}
 }
 
@@ -561,9 +916,7 @@ func (s *Server) handleDeleteFiles(c *gin.Context) {
 		}
 
 		// 安全检查:只允许删除 output 目录下的文件
-		if !filepath.HasPrefix(filePath, s.config.OutputDir) &&
-			!filepath.HasPrefix(filePath, s.config.DataDir) &&
-			!filepath.HasPrefix(filePath, s.config.TempDir) {
+		if !s.isManagedPath(filePath) {
 			results = append(results, gin.H{
 				"filePath": filePath,
 				"success":  false,
@@ -618,6 +971,68 @@ func (s *Server) handleDeleteFiles(c *gin.Context) {
 
 // ==================== 辅助函数 ====================
 
+// isManagedPath 检查路径是否位于服务管理的 output/data/temp 目录下
+func (s *Server) isManagedPath(path string) bool {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+
+	for _, dir := range []string{s.config.OutputDir, s.config.DataDir, s.config.TempDir} {
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(absDir, absPath)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// downloadURL 获取输出目录中文件通过 /downloads 访问的地址
+func (s *Server) downloadURL(path string) string {
+	rel, err := filepath.Rel(s.config.OutputDir, path)
+	if err != nil {
+		return ""
+	}
+	return "/downloads/" + filepath.ToSlash(rel)
+}
+
+// collectOutputs 列出分段输出目录中的播放列表和清单,主入口排在最前
+func (s *Server) collectOutputs(mainPath string) []task.Output {
+	outputs := []task.Output{{
+		Role:     "main",
+		Path:     mainPath,
+		URL:      s.downloadURL(mainPath),
+		MIMEType: converter.MIMETypeFor(mainPath),
+	}}
+
+	filepath.WalkDir(filepath.Dir(mainPath), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || path == mainPath {
+			return nil
+		}
+		role := ""
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".m3u8":
+			role = "playlist"
+		case ".mpd":
+			role = "manifest"
+		default:
+			return nil
+		}
+		outputs = append(outputs, task.Output{
+			Role:     role,
+			Path:     path,
+			URL:      s.downloadURL(path),
+			MIMEType: converter.MIMETypeFor(path),
+		})
+		return nil
+	})
+	return outputs
+}
+
 // generateTaskID 生成任务ID
 func generateTaskID() string {
 	return fmt.Sprintf("task_%d", timeNow().UnixNano())
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"goalfy-mediaconverter/internal/converter"
+	"goalfy-mediaconverter/internal/progress"
+	"goalfy-mediaconverter/internal/task"
+	"goalfy-mediaconverter/internal/upload"
+
+	"github.com/gin-gonic/gin"
+)
+
+// startLiveIngest 为实时接收的上传创建转换任务并启动 FFmpeg
+// 任务在实时接收专用的工作槽中排队,不与点播转换争抢;排队期间到达的切片暂存在磁盘上,开始后依次送入 FFmpeg
+func (s *Server) startLiveIngest(uploadTask *upload.UploadTask, format string) (*task.Task, error) {
+	opts := converter.DefaultOptions()
+	liveTask := s.taskMgr.CreateWithOptions(s.uploadMgr.MergedPathFor(uploadTask), "", format, uploadTask.UploadID, opts.Quality, opts)
+	s.taskMgr.SetOutputPath(liveTask.ID, converter.LiveOutputPath(s.config.OutputDir, liveTask.ID, format))
+
+	err := s.uploadMgr.StartLive(uploadTask.UploadID, func(ctx context.Context, _ *upload.UploadTask, r io.Reader) error {
+		result := make(chan error, 1)
+		s.queue.Submit(task.Job{
+			Task:  liveTask,
+			Class: task.ClassLive,
+			Run: func(t *task.Task) {
+				result <- s.runLiveTask(t, format, r)
+			},
+		})
+
+		// 排队期间任务被取消时作业不会执行
+		// 上传被取消时同时取消任务,否则排队中的作业一直不读取,切片写入会阻塞到队列空出
+		select {
+		case err := <-result:
+			return err
+		case <-liveTask.Context().Done():
+			return fmt.Errorf("任务已取消")
+		case <-ctx.Done():
+			s.taskMgr.Delete(liveTask.ID)
+			return fmt.Errorf("上传已取消")
+		}
+	})
+	if err != nil {
+		s.taskMgr.Delete(liveTask.ID)
+		return nil, err
+	}
+	return liveTask, nil
+}
+
+// runLiveTask 执行实时转换,阻塞直到录制结束且转换完成
+func (s *Server) runLiveTask(t *task.Task, format string, r io.Reader) error {
+	s.taskMgr.UpdateStatus(t.ID, task.StatusProcessing, 0)
+
+	updates := make(chan progress.Progress, 10)
+	done := make(chan error, 1)
+
+	go func() {
+		done <- s.converter.ConvertLive(t.Context(), r, t.OutputPath, format, updates)
+	}()
+
+	for p := range updates {
+		s.taskMgr.UpdateProgress(t.ID, encodeProgress(p))
+	}
+
+	if err := <-done; err != nil {
+		log.Printf("任务 %s 实时转换失败: %v", t.ID, err)
+		s.taskMgr.UpdateError(t.ID, err)
+		return err
+	}
+
+	// 记录输出文件的媒体信息,探测失败不影响任务结果
+	if info, err := s.prober.Probe(t.Context(), t.OutputPath); err == nil {
+		s.taskMgr.SetMediaInfo(t.ID, info)
+	} else {
+		log.Printf("⚠️  获取任务 %s 输出媒体信息失败: %v", t.ID, err)
+	}
+
+	if taskFormat(t).Segmented() {
+		s.taskMgr.SetOutputs(t.ID, s.collectOutputs(t.OutputPath))
+	}
+
+	s.taskMgr.MarkCompleted(t.ID)
+	log.Printf("任务 %s 实时转换完成", t.ID)
+	return nil
+}
+
+// handleUploadFinish 结束实时接收
+// POST /api/upload/finish/:uploadId
+// wait 为 true 时等待转换完成后再返回,客户端断开时停止等待(转换继续进行)
+func (s *Server) handleUploadFinish(c *gin.Context) {
+	uploadID := c.Param("uploadId")
+
+	var req struct {
+		TotalChunks int  `json:"totalChunks" binding:"required"`
+		Wait        bool `json:"wait"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "缺少必要参数: totalChunks",
+		})
+		return
+	}
+
+	if _, err := s.uploadMgr.GetUploadTask(uploadID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "上传任务不存在",
+		})
+		return
+	}
+
+	done, err := s.uploadMgr.FinishLive(uploadID, req.TotalChunks)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if req.Wait {
+		select {
+		case <-done:
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+
+	missingChunks, _ := s.uploadMgr.MissingChunks(uploadID)
+	data := gin.H{
+		"uploadId":      uploadID,
+		"totalChunks":   req.TotalChunks,
+		"missingChunks": missingChunks,
+	}
+	if liveTask := s.findLiveTask(uploadID); liveTask != nil {
+		data["taskId"] = liveTask.ID
+		data["status"] = liveTask.Status
+		data["outputPath"] = liveTask.OutputPath
+		data["error"] = liveTask.Error
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "录制已结束",
+		"data":    data,
+	})
+}
+
+// findLiveTask 查找实时接收上传对应的转换任务
+func (s *Server) findLiveTask(uploadID string) *task.Task {
+	for _, t := range s.taskMgr.List() {
+		if t.Type == task.TypeConvert && t.UploadID == uploadID {
+			return t
+		}
+	}
+	return nil
+}
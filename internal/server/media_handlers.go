@@ -0,0 +1,116 @@
+package server
+
+import (
+	"net/http"
+	"os"
+
+	"goalfy-mediaconverter/internal/task"
+	"goalfy-mediaconverter/internal/upload"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleMediaInfo 查询媒体文件信息
+// GET /api/media/info?uploadId=xxx | taskId=xxx | path=xxx
+func (s *Server) handleMediaInfo(c *gin.Context) {
+	uploadID := c.Query("uploadId")
+	taskID := c.Query("taskId")
+	path := c.Query("path")
+
+	var filePath string
+	switch {
+	case uploadID != "":
+		uploadTask, err := s.uploadMgr.GetUploadTask(uploadID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": "上传任务不存在",
+			})
+			return
+		}
+		if uploadTask.Status != upload.UploadStatusMerged {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "文件尚未合并完成,当前状态: " + string(uploadTask.Status),
+			})
+			return
+		}
+		filePath = uploadTask.MergedPath
+
+	case taskID != "":
+		t, err := s.taskMgr.Get(taskID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": "任务不存在",
+			})
+			return
+		}
+
+		// 已完成的任务查询输出文件,否则查询输入文件
+		filePath = t.InputPath
+		if t.Status == task.StatusCompleted {
+			if t.MediaInfo != nil {
+				c.JSON(http.StatusOK, gin.H{
+					"success": true,
+					"data":    t.MediaInfo,
+				})
+				return
+			}
+			filePath = t.OutputPath
+		}
+		// 未拼接的切割任务和缩略图任务没有单个输出文件
+		if filePath == "" {
+			message := "任务没有可查询的输出文件"
+			if t.Type == task.TypeSplit {
+				message = "切割任务未拼接完整文件,请通过 path 查询各片段的媒体信息"
+			}
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": message,
+			})
+			return
+		}
+
+	case path != "":
+		// 安全检查:只允许查询服务管理目录下的文件
+		if !s.isManagedPath(path) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"success": false,
+				"message": "无权限访问此文件(仅允许 output/data/temp 目录下的文件)",
+			})
+			return
+		}
+		filePath = path
+
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "必须提供 uploadId、taskId 或 path",
+		})
+		return
+	}
+
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "文件不存在",
+		})
+		return
+	}
+
+	info, err := s.prober.Probe(c.Request.Context(), filePath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "获取媒体信息失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    info,
+	})
+}
@@ -4,11 +4,17 @@ import (
 	"fmt"
 	"goalfy-mediaconverter/internal/config"
 	"goalfy-mediaconverter/internal/converter"
+	"goalfy-mediaconverter/internal/gpu"
+	"goalfy-mediaconverter/internal/probe"
 	"goalfy-mediaconverter/internal/split"
+	"goalfy-mediaconverter/internal/store"
 	"goalfy-mediaconverter/internal/task"
+	"goalfy-mediaconverter/internal/thumbnail"
+	"goalfy-mediaconverter/internal/trash"
 	"goalfy-mediaconverter/internal/upload"
 	"log"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -16,31 +22,115 @@ import (
 
 // Server HTTP 服务器
 type Server struct {
-	config    *config.Config
-	converter *converter.Converter
-	splitter  *split.Splitter
-	taskMgr   *task.Manager
-	uploadMgr *upload.Manager
-	router    *gin.Engine
+	config      *config.Config
+	converter   *converter.Converter
+	ladder      []converter.Rendition // 转换请求 options.ladder 为 true 时使用的码率阶梯
+	splitter    *split.Splitter
+	thumbnailer *thumbnail.Generator
+	prober      *probe.Prober
+	taskMgr     *task.Manager
+	queue       *task.Queue
+	uploadMgr   *upload.Manager
+	trash       *trash.Trash
+	router      *gin.Engine
 }
 
 // New 创建服务器
 func New(cfg *config.Config) *Server {
 	gin.SetMode(gin.ReleaseMode)
 
+	// 让 /downloads 静态文件服务返回各输出格式正确的 Content-Type
+	converter.RegisterMIMETypes()
+
+	ladder := converter.DefaultLadder()
+	if len(cfg.Ladder) > 0 {
+		configured := renditionsFromConfig(cfg.Ladder)
+		if err := converter.ValidateLadder(configured); err != nil {
+			log.Printf("⚠️  配置中的码率阶梯无效: %v, 使用默认阶梯", err)
+		} else {
+			ladder = configured
+		}
+	}
+
+	// 持久化存储不可用时退化为纯内存模式,服务仍可运行
+	st, err := store.New(cfg.StoreDir)
+	if err != nil {
+		log.Printf("⚠️  初始化持久化存储失败: %v, 任务记录将不会在重启后保留", err)
+		st = nil
+	}
+
+	// 转换器和切割器共享硬件编码会话,两者同时运行时也不会超出编码器的会话数限制
+	gpuSessions := gpu.NewSessions(cfg.MaxGPUSessions)
+
 	s := &Server{
-		config:    cfg,
-		converter: converter.New(cfg.FFmpegPath),
-		splitter:  split.New(cfg.FFmpegPath, cfg.OutputDir),
-		taskMgr:   task.NewManager(),
-		uploadMgr: upload.NewManager(cfg.TempDir, cfg.DataDir),
-		router:    gin.Default(),
+		config:      cfg,
+		converter:   converter.New(cfg.FFmpegPath, cfg.TempDir, gpuSessions),
+		ladder:      ladder,
+		splitter:    split.New(cfg.FFmpegPath, cfg.OutputDir, cfg.MaxSplitWorkers, gpuSessions),
+		thumbnailer: thumbnail.New(cfg.FFmpegPath),
+		prober:      probe.New(cfg.FFmpegPath),
+		taskMgr:     task.NewManager(st),
+		uploadMgr:   upload.NewManager(cfg.TempDir, cfg.DataDir, st),
+		trash:       trash.New(cfg.TrashDir, time.Duration(cfg.TrashRetentionHours)*time.Hour),
+		router:      gin.Default(),
 	}
+	s.queue = task.NewQueue(s.taskMgr, cfg.MaxGPUJobs, cfg.MaxCPUJobs, cfg.MaxLiveJobs)
+
+	// 合并后修复 MediaRecorder 录制文件缺失的时长和索引,保证转换进度和切割点准确
+	s.uploadMgr.SetIngest(s.converter.RepairRecording)
 
 	s.setupRoutes()
+	s.resumeInterrupted()
+	s.trash.Start()
 	return s
 }
 
+// resumeInterrupted 恢复服务重启前未完成的上传合并和转换任务
+func (s *Server) resumeInterrupted() {
+	for _, uploadID := range s.uploadMgr.PendingMerges() {
+		log.Printf("🔄 继续合并重启前未完成的上传: %s", uploadID)
+		go func(id string) {
+			if err := s.uploadMgr.MergeChunks(id); err != nil {
+				log.Printf("合并切片失败: %v", err)
+			}
+		}(uploadID)
+	}
+
+	for _, t := range s.taskMgr.Interrupted() {
+		if _, err := os.Stat(t.InputPath); err != nil {
+			s.taskMgr.UpdateError(t.ID, fmt.Errorf("服务重启时任务被中断,且输入文件已不存在: %s", t.InputPath))
+			continue
+		}
+
+		log.Printf("🔄 重新排队重启前被中断的任务: %s", t.ID)
+		s.taskMgr.UpdateStatus(t.ID, task.StatusPending, 0)
+		switch t.Type {
+		case task.TypeSplit:
+			s.enqueueSplitTask(t, t.Priority)
+		case task.TypeThumbnail:
+			s.enqueueThumbnailTask(t, t.Priority)
+		case task.TypeAudio:
+			s.enqueueAudioTask(t, t.Priority)
+		default:
+			s.enqueueConvertTask(t, t.Priority)
+		}
+	}
+}
+
+// renditionsFromConfig 将配置中的码率阶梯转换为转换器的档位
+func renditionsFromConfig(ladder []config.Rendition) []converter.Rendition {
+	renditions := make([]converter.Rendition, len(ladder))
+	for i, r := range ladder {
+		renditions[i] = converter.Rendition{
+			Name:         r.Name,
+			Height:       r.Height,
+			VideoBitrate: r.VideoBitrate,
+			AudioBitrate: r.AudioBitrate,
+		}
+	}
+	return renditions
+}
+
 // setupRoutes 设置路由(完全兼容 video-service)
 func (s *Server) setupRoutes() {
 	// CORS 中间件
@@ -56,16 +146,19 @@ func (s *Server) setupRoutes() {
 			upload.POST("/chunk", s.handleUploadChunk)
 			upload.GET("/status/:uploadId", s.handleUploadStatus)
 			upload.POST("/cancel/:uploadId", s.handleUploadCancel)
+			upload.POST("/finish/:uploadId", s.handleUploadFinish)
 		}
 
 		// 转换模块
 		convert := api.Group("/convert")
 		{
 			convert.POST("/start", s.handleConvertStart)
+			convert.POST("/stream", s.handleConvertStream)
 			convert.GET("/status/:taskId", s.handleConvertStatus)
 			convert.POST("/cancel/:taskId", s.handleConvertCancel)
 			convert.GET("/list", s.handleConvertList)
 			convert.GET("/download/:taskId", s.handleConvertDownload)
+			convert.POST("/restore/:taskId", s.handleConvertRestore)
 		}
 
 		// 进度查询模块
@@ -80,13 +173,35 @@ func (s *Server) setupRoutes() {
 			files.POST("/delete", s.handleDeleteFiles)
 		}
 
+		// 媒体信息模块
+		media := api.Group("/media")
+		{
+			media.GET("/info", s.handleMediaInfo)
+		}
+
 		// 视频切割模块
 		splitAPI := api.Group("/split")
 		{
 			splitAPI.POST("/start", s.handleSplitStart)
+			splitAPI.POST("/cancel/:taskId", s.handleConvertCancel)
 			splitAPI.GET("/download/:taskId/:segmentIndex", s.handleSplitDownload)
+			splitAPI.GET("/archive/:taskId", s.handleSplitArchive)
 			splitAPI.DELETE("/cleanup/:taskId", s.handleSplitCleanup)
 		}
+
+		// 缩略图模块
+		thumbnailAPI := api.Group("/thumbnail")
+		{
+			thumbnailAPI.POST("/start", s.handleThumbnailStart)
+			thumbnailAPI.POST("/cancel/:taskId", s.handleConvertCancel)
+		}
+
+		// 音频提取模块
+		audioAPI := api.Group("/audio")
+		{
+			audioAPI.POST("/start", s.handleAudioStart)
+			audioAPI.POST("/cancel/:taskId", s.handleConvertCancel)
+		}
 	}
 
 	// 健康检查
@@ -96,6 +211,7 @@ func (s *Server) setupRoutes() {
 			"timestamp": time.Now().Format(time.RFC3339),
 			"service":   "goalfy-mediaconverter",
 			"version":   "1.0.0",
+			"queue":     s.queue.Stats(),
 		})
 	})
 
@@ -117,7 +233,7 @@ func (s *Server) Start() error {
 	log.Printf("📂 数据目录: %s", s.config.DataDir)
 	log.Printf("📂 临时目录: %s", s.config.TempDir)
 	log.Printf("📂 输出目录: %s", s.config.OutputDir)
-	log.Println("===========================================\n")
+	log.Println("===========================================")
 
 	// 启动 HTTP 服务
 	srv := &http.Server{
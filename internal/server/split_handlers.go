@@ -1,9 +1,19 @@
 package server
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"goalfy-mediaconverter/internal/split"
+	"goalfy-mediaconverter/internal/task"
+	"io"
+	"log"
 	"net/http"
+	"os"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -31,15 +41,15 @@ func (s *Server) handleSplitStart(c *gin.Context) {
 		return
 	}
 
-	if req.DeleteIntervals == nil {
+	if err := split.ValidateStrategy(req); err != nil {
 		c.JSON(http.StatusBadRequest, split.SplitResponse{
 			Success: false,
-			Error:   "deleteIntervals必须是数组",
+			Error:   err.Error(),
 		})
 		return
 	}
 
-	if req.VideoDuration <= 0 {
+	if req.VideoDuration < 0 {
 		c.JSON(http.StatusBadRequest, split.SplitResponse{
 			Success: false,
 			Error:   "无效的videoDuration",
@@ -47,8 +57,45 @@ func (s *Server) handleSplitStart(c *gin.Context) {
 		return
 	}
 
+	if !split.IsValidMode(req.Mode) {
+		c.JSON(http.StatusBadRequest, split.SplitResponse{
+			Success: false,
+			Error:   "不支持的切割模式: " + req.Mode,
+		})
+		return
+	}
+	if req.AudioFade < 0 || req.AudioFade > split.MaxAudioFade {
+		c.JSON(http.StatusBadRequest, split.SplitResponse{
+			Success: false,
+			Error:   fmt.Sprintf("audioFade 必须在 0-%.0f 秒之间", split.MaxAudioFade),
+		})
+		return
+	}
+	if req.Concurrency < 0 {
+		c.JSON(http.StatusBadRequest, split.SplitResponse{
+			Success: false,
+			Error:   "无效的concurrency",
+		})
+		return
+	}
+
+	if !split.IsValidFailurePolicy(req.FailurePolicy) {
+		c.JSON(http.StatusBadRequest, split.SplitResponse{
+			Success: false,
+			Error:   "不支持的失败策略: " + req.FailurePolicy,
+		})
+		return
+	}
+
+	if req.Mode == "" {
+		req.Mode = split.ModeReencode
+	}
+	if req.Strategy == "" {
+		req.Strategy = split.StrategyDelete
+	}
+
 	// 🔍 从任务管理器获取输出文件路径
-	task, err := s.taskMgr.Get(req.TaskID)
+	sourceTask, err := s.taskMgr.Get(req.TaskID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, split.SplitResponse{
 			Success: false,
@@ -58,33 +105,221 @@ func (s *Server) handleSplitStart(c *gin.Context) {
 	}
 
 	// 检查任务是否已完成
-	if task.Status != "completed" {
+	if sourceTask.Status != task.StatusCompleted {
 		c.JSON(http.StatusBadRequest, split.SplitResponse{
 			Success: false,
-			Error:   "任务尚未完成,当前状态: " + string(task.Status),
+			Error:   "任务尚未完成,当前状态: " + string(sourceTask.Status),
+		})
+		return
+	}
+
+	// 源文件已在上一次切割后移入回收站时,先恢复再切割
+	if sourceTask.TrashedPath != "" {
+		if err := s.restoreSource(sourceTask); err != nil {
+			c.JSON(http.StatusGone, split.SplitResponse{
+				Success: false,
+				Error:   "恢复源文件失败: " + err.Error(),
+			})
+			return
+		}
+	}
+
+	if sourceTask.OutputPath == "" {
+		c.JSON(http.StatusBadRequest, split.SplitResponse{
+			Success: false,
+			Error:   "任务没有可切割的输出文件: " + req.TaskID,
+		})
+		return
+	}
+
+	if taskFormat(sourceTask).Segmented() {
+		c.JSON(http.StatusBadRequest, split.SplitResponse{
+			Success: false,
+			Error:   "分段格式(" + sourceTask.OutputFormat + ")的输出不支持切割: " + req.TaskID,
 		})
 		return
 	}
 
 	// 将输出文件路径传递给切割函数
-	req.InputPath = task.OutputPath
+	req.InputPath = sourceTask.OutputPath
 
-	// 执行切割
-	result, err := s.splitter.SplitVideo(req)
+	// 同步校验请求,校验失败时直接返回;场景检测等耗时步骤在任务执行时进行
+	plan, failure := s.splitter.Validate(c.Request.Context(), req)
+	if failure != nil {
+		status := http.StatusInternalServerError
+		if len(failure.IntervalErrors) > 0 {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, failure)
+		return
+	}
+
+	// 创建切割任务并加入队列,通过 /api/progress/:id 查询进度
+	splitTask := s.taskMgr.CreateSplit(sourceTask, req.InputPath, req)
+	s.enqueueSplitTask(splitTask, 0)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":             true,
+		"message":             "切割任务已加入队列",
+		"taskId":              splitTask.ID,
+		"sourceTaskId":        sourceTask.ID,
+		"status":              splitTask.Status,
+		"queuePosition":       splitTask.QueuePosition,
+		"strategy":            plan.Strategy,
+		"mode":                plan.Mode,
+		"totalSegments":       len(plan.Segments),
+		"join":                req.Join,
+		"videoDuration":       plan.VideoDuration,
+		"normalizedIntervals": plan.Intervals,
+		"intervalWarnings":    plan.Warnings,
+	})
+}
+
+// enqueueSplitTask 将切割任务加入队列
+func (s *Server) enqueueSplitTask(t *task.Task, priority int) {
+	class := task.ClassCPU
+	if req, err := splitRequest(t); err == nil && s.splitter.UsesGPU(req.Mode) {
+		class = task.ClassGPU
+	}
+
+	s.queue.Submit(task.Job{
+		Task:     t,
+		Class:    class,
+		Priority: priority,
+		Run:      s.processSplitTask,
+	})
+}
+
+// processSplitTask 执行切割任务,阻塞直到切割结束
+func (s *Server) processSplitTask(t *task.Task) {
+	s.taskMgr.UpdateStatus(t.ID, task.StatusProcessing, 0)
+
+	fail := func(err error) {
+		log.Printf("切割任务 %s 失败: %v", t.ID, err)
+		s.taskMgr.UpdateError(t.ID, err)
+
+		// 清理已生成的片段
+		if _, cleanupErr := s.splitter.CleanupSplitFiles(t.ID, nil); cleanupErr != nil {
+			log.Printf("⚠️  清理切割任务 %s 的片段失败: %v", t.ID, cleanupErr)
+		}
+	}
+
+	req, err := splitRequest(t)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, split.SplitResponse{
-			Success: false,
-			Error:   "切割失败: " + err.Error(),
+		fail(err)
+		return
+	}
+
+	plan, failure := s.splitter.Plan(t.Context(), *req)
+	if failure != nil {
+		fail(fmt.Errorf("%s", failure.Error))
+		return
+	}
+
+	result, err := s.splitter.SplitVideo(t.Context(), t.ID, *req, plan, func(p split.SplitProgress) {
+		s.taskMgr.UpdateSplitProgress(t.ID, p.Overall, p.Segments)
+	})
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	joinedPath := ""
+	if result.Joined != nil {
+		joinedPath = result.Joined.OutputPath
+	}
+	s.taskMgr.SetSplitResult(t.ID, result.Segments, joinedPath)
+	s.taskMgr.MarkCompleted(t.ID)
+	log.Printf("切割任务 %s 完成: %d 个片段", t.ID, result.TotalSegments)
+
+	if !req.KeepSource {
+		s.trashSource(t)
+	}
+}
+
+// trashSource 切割完成后将源文件移入回收站(节省空间)
+// 仍有其他切割任务在使用该源文件时保留
+func (s *Server) trashSource(splitTask *task.Task) {
+	for _, other := range s.taskMgr.List() {
+		if other.ID != splitTask.ID && other.Type == task.TypeSplit && other.InputPath == splitTask.InputPath &&
+			(other.Status == task.StatusPending || other.Status == task.StatusProcessing) {
+			log.Printf("ℹ️  源文件仍被切割任务 %s 使用,暂不移入回收站", other.ID)
+			return
+		}
+	}
+
+	if _, err := os.Stat(splitTask.InputPath); err != nil {
+		return
+	}
+
+	trashedPath, err := s.trash.Move(splitTask.InputPath)
+	if err != nil {
+		log.Printf("⚠️  移除源文件失败: %v", err)
+		return
+	}
+	if trashedPath == "" {
+		log.Printf("🗑️  已删除原始完整文件: %s", splitTask.InputPath)
+		return
+	}
+
+	if _, err := s.taskMgr.Get(splitTask.SourceTaskID); err == nil {
+		s.taskMgr.SetTrashed(splitTask.SourceTaskID, trashedPath)
+	}
+}
+
+// restoreSource 将任务在回收站中的输出文件恢复到原路径
+func (s *Server) restoreSource(t *task.Task) error {
+	if err := s.trash.Restore(t.TrashedPath, t.OutputPath); err != nil {
+		return err
+	}
+	return s.taskMgr.SetTrashed(t.ID, "")
+}
+
+// handleConvertRestore 处理恢复回收站中的输出文件请求
+// POST /api/convert/restore/:taskId
+func (s *Server) handleConvertRestore(c *gin.Context) {
+	taskID := c.Param("taskId")
+
+	t, err := s.taskMgr.Get(taskID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "任务不存在",
 		})
 		return
 	}
 
-	// 返回结果
-	if result.Success {
-		c.JSON(http.StatusOK, result)
-	} else {
-		c.JSON(http.StatusInternalServerError, result)
+	if t.TrashedPath == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "输出文件不在回收站中",
+		})
+		return
 	}
+
+	if _, err := os.Stat(t.TrashedPath); err != nil {
+		c.JSON(http.StatusGone, gin.H{
+			"success": false,
+			"message": "输出文件已超过保留期被清除",
+		})
+		return
+	}
+
+	if err := s.restoreSource(t); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "恢复文件失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":    true,
+		"message":    "输出文件已恢复",
+		"taskId":     taskID,
+		"outputPath": t.OutputPath,
+	})
 }
 
 // handleSplitDownload 处理片段下载请求
@@ -112,23 +347,246 @@ func (s *Server) handleSplitDownload(c *gin.Context) {
 		return
 	}
 
-	// 查找文件
-	filePath, err := s.splitter.FindSegmentFile(taskID, segmentIndex)
-	if err != nil {
+	// 从任务记录中查找片段文件
+	segment := s.findSegment(taskID, segmentIndex)
+	if segment == nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"success": false,
 			"error":   "未找到片段文件: " + taskID + " - part" + segmentIndexStr,
 		})
 		return
 	}
+	if _, err := os.Stat(segment.OutputPath); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "片段文件已被删除: " + taskID + " - part" + segmentIndexStr,
+		})
+		return
+	}
 
 	// 设置响应头
 	c.Header("Content-Type", "video/mp4")
 	c.Header("Accept-Ranges", "bytes")
-	c.Header("Content-Disposition", "attachment; filename=\""+taskID+"_part"+segmentIndexStr+".mp4\"")
+	c.Header("Content-Disposition", "attachment; filename=\""+segment.FileName+"\"")
 
 	// 流式传输文件
-	c.File(filePath)
+	c.File(segment.OutputPath)
+}
+
+// findSegment 从切割任务记录中查找切割成功的片段,不存在时返回 nil
+func (s *Server) findSegment(taskID string, segmentIndex int) *split.SegmentResult {
+	t, err := s.taskMgr.Get(taskID)
+	if err != nil || t.Type != task.TypeSplit {
+		return nil
+	}
+	segments := splitSegments(t)
+	for i := range segments {
+		if segments[i].SegmentIndex == segmentIndex && segments[i].Success {
+			return &segments[i]
+		}
+	}
+	return nil
+}
+
+// splitRequest 解析切割任务保存的切割参数
+func splitRequest(t *task.Task) (*split.SplitRequest, error) {
+	req, err := task.Decode[split.SplitRequest](t.Split)
+	if err != nil {
+		return nil, fmt.Errorf("解析切割参数失败: %v", err)
+	}
+	if req == nil {
+		return nil, fmt.Errorf("切割任务缺少切割参数")
+	}
+	return req, nil
+}
+
+// splitSegments 解析切割任务记录的片段结果,尚无结果时返回空
+func splitSegments(t *task.Task) []split.SegmentResult {
+	segments, err := task.Decode[[]split.SegmentResult](t.Segments)
+	if err != nil {
+		log.Printf("⚠️  解析切割任务 %s 的片段结果失败: %v", t.ID, err)
+	}
+	if segments == nil {
+		return nil
+	}
+	return *segments
+}
+
+// archiveManifestEntry 打包清单中的片段信息
+type archiveManifestEntry struct {
+	SegmentIndex  int     `json:"segmentIndex"`
+	FileName      string  `json:"fileName"`
+	Size          int64   `json:"size"`
+	Duration      float64 `json:"duration"`
+	StartTime     float64 `json:"startTime"`
+	EndTime       float64 `json:"endTime"`
+	OriginalStart float64 `json:"originalStart"`
+	OriginalEnd   float64 `json:"originalEnd"`
+	Title         string  `json:"title,omitempty"`
+}
+
+// archiveWriter 打包格式的统一封装
+type archiveWriter interface {
+	// add 向包中写入一个文件
+	add(name string, size int64, modTime time.Time, r io.Reader) error
+	Close() error
+}
+
+// zipArchive ZIP 打包,视频已经过压缩,使用 Store 方式不再压缩
+type zipArchive struct{ w *zip.Writer }
+
+func (a zipArchive) add(name string, size int64, modTime time.Time, r io.Reader) error {
+	w, err := a.w.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Store,
+		Modified: modTime,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+func (a zipArchive) Close() error { return a.w.Close() }
+
+// tarArchive tar 打包
+type tarArchive struct{ w *tar.Writer }
+
+func (a tarArchive) add(name string, size int64, modTime time.Time, r io.Reader) error {
+	if err := a.w.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    size,
+		ModTime: modTime,
+	}); err != nil {
+		return err
+	}
+	_, err := io.Copy(a.w, r)
+	return err
+}
+
+func (a tarArchive) Close() error { return a.w.Close() }
+
+// handleSplitArchive 将切割任务的所有片段打包下载
+// GET /api/split/archive/:taskId?format=zip|tar&manifest=1
+// 边读取边写入响应,不在磁盘上生成临时压缩包
+func (s *Server) handleSplitArchive(c *gin.Context) {
+	taskID := c.Param("taskId")
+
+	format := c.DefaultQuery("format", "zip")
+	if format != "zip" && format != "tar" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "不支持的打包格式: " + format,
+		})
+		return
+	}
+	withManifest := c.Query("manifest") == "1" || c.Query("manifest") == "true"
+
+	splitTask, err := s.taskMgr.Get(taskID)
+	if err != nil || splitTask.Type != task.TypeSplit {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "未找到切割任务: " + taskID,
+		})
+		return
+	}
+
+	if splitTask.Status != task.StatusCompleted {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "切割任务尚未完成,当前状态: " + string(splitTask.Status),
+		})
+		return
+	}
+
+	// 开始写入响应后无法再返回错误,先确认所有片段文件都存在
+	var segments []split.SegmentResult
+	var manifest []archiveManifestEntry
+	for _, segment := range splitSegments(splitTask) {
+		if !segment.Success {
+			continue
+		}
+		info, err := os.Stat(segment.OutputPath)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"error":   fmt.Sprintf("未找到片段文件: %s - part%d", taskID, segment.SegmentIndex),
+			})
+			return
+		}
+		segment.Size = info.Size()
+		segments = append(segments, segment)
+		manifest = append(manifest, archiveManifestEntry{
+			SegmentIndex:  segment.SegmentIndex,
+			FileName:      segment.FileName,
+			Size:          segment.Size,
+			Duration:      segment.Duration,
+			StartTime:     segment.StartTime,
+			EndTime:       segment.EndTime,
+			OriginalStart: segment.OriginalStart,
+			OriginalEnd:   segment.OriginalEnd,
+			Title:         segment.Title,
+		})
+	}
+
+	if len(segments) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "切割任务没有可下载的片段",
+		})
+		return
+	}
+
+	// 设置响应头
+	var archive archiveWriter
+	if format == "zip" {
+		c.Header("Content-Type", "application/zip")
+		archive = zipArchive{zip.NewWriter(c.Writer)}
+	} else {
+		c.Header("Content-Type", "application/x-tar")
+		archive = tarArchive{tar.NewWriter(c.Writer)}
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s_segments.%s"`, taskID, format))
+	c.Status(http.StatusOK)
+
+	abort := func(err error) {
+		log.Printf("⚠️  打包切割任务 %s 失败: %v", taskID, err)
+	}
+
+	if withManifest {
+		data, _ := json.MarshalIndent(gin.H{
+			"taskId":       taskID,
+			"sourceTaskId": splitTask.SourceTaskID,
+			"segments":     manifest,
+		}, "", "  ")
+		if err := archive.add("manifest.json", int64(len(data)), time.Now(), bytes.NewReader(data)); err != nil {
+			abort(err)
+			return
+		}
+	}
+
+	for _, segment := range segments {
+		file, err := os.Open(segment.OutputPath)
+		if err != nil {
+			abort(err)
+			return
+		}
+		info, err := file.Stat()
+		if err == nil {
+			err = archive.add(segment.FileName, info.Size(), info.ModTime(), file)
+		}
+		file.Close()
+		if err != nil {
+			abort(err)
+			return
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		abort(err)
+	}
 }
 
 // handleSplitCleanup 处理清理切割文件请求
@@ -144,8 +602,29 @@ func (s *Server) handleSplitCleanup(c *gin.Context) {
 		return
 	}
 
+	// 只清理切割任务: 输出子目录以任务ID命名,不能按目录名猜测,否则会删掉其他任务的输出
+	t, err := s.taskMgr.Get(taskID)
+	if err != nil || t.Type != task.TypeSplit {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "未找到切割任务: " + taskID,
+		})
+		return
+	}
+
+	// 按任务记录中的路径清理,并删除任务的输出子目录
+	var paths []string
+	for _, segment := range splitSegments(t) {
+		if segment.OutputPath != "" {
+			paths = append(paths, segment.OutputPath)
+		}
+	}
+	if t.OutputPath != "" {
+		paths = append(paths, t.OutputPath)
+	}
+
 	// 执行清理
-	count, err := s.splitter.CleanupSplitFiles(taskID)
+	count, err := s.splitter.CleanupSplitFiles(taskID, paths)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
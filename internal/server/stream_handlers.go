@@ -0,0 +1,107 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxStreamBodySize 流式转换接口允许的最大请求体(字节)
+// 大文件应使用分片上传 + 异步转换
+const maxStreamBodySize = 200 << 20
+
+// flushWriter 每次写入后立即刷新,让客户端尽快收到 FFmpeg 产出的数据
+type flushWriter struct {
+	w gin.ResponseWriter
+}
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	f.w.Flush()
+	return n, err
+}
+
+// bodyReader 记录读取请求体时的错误,FFmpeg 只会报告输入被截断
+type bodyReader struct {
+	r   io.Reader
+	err error
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if err != nil && err != io.EOF {
+		b.err = err
+	}
+	return n, err
+}
+
+// handleConvertStream 处理流式转换请求
+// POST /api/convert/stream
+// 请求体为 WebM 数据,响应体为 FFmpeg 边转换边输出的分片 MP4;客户端断开时终止转换
+func (s *Server) handleConvertStream(c *gin.Context) {
+	if c.Request.ContentLength == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "请求体为空",
+		})
+		return
+	}
+	if c.Request.ContentLength > maxStreamBodySize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"success": false,
+			"message": "文件过大,请使用分片上传接口",
+		})
+		return
+	}
+
+	body := &bodyReader{r: http.MaxBytesReader(c.Writer, c.Request.Body, maxStreamBodySize)}
+
+	// HTTP/1.x 默认在开始写响应后不能再读取请求体,边读边写需要全双工
+	if err := http.NewResponseController(c.Writer).EnableFullDuplex(); err != nil {
+		log.Printf("⚠️  无法启用全双工,客户端需在上传完成后才能收到数据: %v", err)
+	}
+
+	c.Header("Content-Type", "video/mp4")
+	c.Header("Content-Disposition", `inline; filename="converted.mp4"`)
+
+	// 请求上下文在客户端断开时取消,ConvertStream 随之终止 FFmpeg
+	err := s.converter.ConvertStream(c.Request.Context(), body, flushWriter{c.Writer})
+	if err == nil {
+		return
+	}
+
+	if c.Request.Context().Err() != nil {
+		log.Printf("ℹ️  客户端已断开,流式转换已终止")
+		return
+	}
+	log.Printf("流式转换失败: %v", err)
+
+	// 已经开始输出数据时无法再返回错误响应,直接断开连接让客户端知道数据不完整
+	if c.Writer.Written() {
+		if conn, _, err := c.Writer.Hijack(); err == nil {
+			conn.Close()
+		}
+		return
+	}
+
+	c.Writer.Header().Del("Content-Type")
+	c.Writer.Header().Del("Content-Disposition")
+
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(body.err, &maxBytesErr) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"success": false,
+			"message": "文件过大,请使用分片上传接口",
+		})
+		return
+	}
+
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"success": false,
+		"message": "转换失败",
+		"error":   err.Error(),
+	})
+}
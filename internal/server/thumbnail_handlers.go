@@ -0,0 +1,119 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"goalfy-mediaconverter/internal/task"
+	"goalfy-mediaconverter/internal/thumbnail"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleThumbnailStart 处理缩略图生成请求
+// POST /api/thumbnail/start
+// 输入可以是已合并的上传、本地文件或已完成的转换任务的输出
+func (s *Server) handleThumbnailStart(c *gin.Context) {
+	var req struct {
+		UploadID string `json:"uploadId"`
+		FilePath string `json:"filePath"`
+		TaskID   string `json:"taskId"`
+		Priority int    `json:"priority"`
+		thumbnail.Options
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "请求参数错误",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	if err := req.Options.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	inputPath, ok := s.resolveInputPath(c, req.UploadID, req.FilePath, req.TaskID, "生成缩略图")
+	if !ok {
+		return
+	}
+
+	thumbnailTask := s.taskMgr.CreateThumbnail(inputPath, req.Options.Format, req.UploadID, req.TaskID, req.Options)
+	s.enqueueThumbnailTask(thumbnailTask, req.Priority)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "缩略图任务已加入队列",
+		"data": gin.H{
+			"taskId":        thumbnailTask.ID,
+			"inputPath":     inputPath,
+			"options":       req.Options,
+			"status":        thumbnailTask.Status,
+			"queuePosition": thumbnailTask.QueuePosition,
+		},
+	})
+}
+
+// enqueueThumbnailTask 将缩略图任务加入队列
+// 截图和雪碧图只做解码和 JPEG/PNG 编码,占用 CPU 工作槽
+func (s *Server) enqueueThumbnailTask(t *task.Task, priority int) {
+	s.queue.Submit(task.Job{
+		Task:     t,
+		Class:    task.ClassCPU,
+		Priority: priority,
+		Run:      s.processThumbnailTask,
+	})
+}
+
+// processThumbnailTask 执行缩略图任务,阻塞直到生成结束
+func (s *Server) processThumbnailTask(t *task.Task) {
+	opts, err := task.Decode[thumbnail.Options](t.Thumbnail)
+	if err == nil && opts == nil {
+		err = fmt.Errorf("任务缺少缩略图参数")
+	}
+	if err != nil {
+		s.taskMgr.UpdateError(t.ID, fmt.Errorf("解析缩略图参数失败: %v", err))
+		return
+	}
+
+	s.taskMgr.UpdateStatus(t.ID, task.StatusProcessing, 0)
+
+	result, err := s.generateThumbnails(t, t.InputPath, *opts, func(percent float64) {
+		s.taskMgr.UpdateThumbnailProgress(t.ID, percent)
+	})
+	if err != nil {
+		log.Printf("缩略图任务 %s 失败: %v", t.ID, err)
+		s.taskMgr.UpdateError(t.ID, err)
+		return
+	}
+
+	s.taskMgr.SetThumbnails(t.ID, result)
+	s.taskMgr.MarkCompleted(t.ID)
+	log.Printf("缩略图任务 %s 完成", t.ID)
+}
+
+// generateThumbnails 为任务生成缩略图并填充访问地址,失败时删除已生成的文件
+func (s *Server) generateThumbnails(t *task.Task, inputPath string, opts thumbnail.Options, onProgress func(float64)) (*thumbnail.Result, error) {
+	dir := s.thumbnailDir(t.ID)
+	result, err := s.thumbnailer.Generate(t.Context(), inputPath, dir, opts, onProgress)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	result.SetURLs(s.downloadURL)
+	return result, nil
+}
+
+// thumbnailDir 获取任务的缩略图目录
+func (s *Server) thumbnailDir(taskID string) string {
+	return filepath.Join(s.config.OutputDir, "thumbnails", taskID)
+}
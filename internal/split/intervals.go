@@ -0,0 +1,69 @@
+package split
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// IntervalError 单个删除区间的校验问题
+type IntervalError struct {
+	Index    int          `json:"index"`    // 在请求 deleteIntervals 中的下标
+	Interval TimeInterval `json:"interval"` // 原始区间
+	Message  string       `json:"message"`  // 问题描述
+}
+
+// normalizeIntervals 校验并规范化删除区间
+// 负数、反向或起点超出时长的区间会被拒绝;终点超出时长的区间截断到视频末尾并给出警告;
+// 通过校验的区间按开始时间排序,重叠或相邻的区间会被合并
+func normalizeIntervals(videoDuration float64, intervals []TimeInterval) (normalized []TimeInterval, errs, warnings []IntervalError) {
+	valid := make([]TimeInterval, 0, len(intervals))
+
+	for i, interval := range intervals {
+		reject := func(format string, args ...interface{}) {
+			errs = append(errs, IntervalError{Index: i, Interval: interval, Message: fmt.Sprintf(format, args...)})
+		}
+
+		switch {
+		case math.IsNaN(interval.Start) || math.IsNaN(interval.End) ||
+			math.IsInf(interval.Start, 0) || math.IsInf(interval.End, 0):
+			reject("区间包含无效数值")
+		case interval.Start < 0:
+			reject("start 不能为负数: %.3f", interval.Start)
+		case interval.End <= interval.Start:
+			reject("end (%.3f) 必须大于 start (%.3f)", interval.End, interval.Start)
+		case interval.Start >= videoDuration:
+			reject("start (%.3f) 超出视频时长 %.3f", interval.Start, videoDuration)
+		default:
+			if interval.End > videoDuration {
+				warnings = append(warnings, IntervalError{
+					Index:    i,
+					Interval: interval,
+					Message:  fmt.Sprintf("end (%.3f) 超出视频时长,已截断为 %.3f", interval.End, videoDuration),
+				})
+				interval.End = videoDuration
+			}
+			valid = append(valid, interval)
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errs, warnings
+	}
+
+	sort.Slice(valid, func(i, j int) bool {
+		return valid[i].Start < valid[j].Start
+	})
+
+	normalized = []TimeInterval{}
+	for _, interval := range valid {
+		last := len(normalized) - 1
+		if last >= 0 && interval.Start <= normalized[last].End {
+			normalized[last].End = math.Max(normalized[last].End, interval.End)
+			continue
+		}
+		normalized = append(normalized, interval)
+	}
+
+	return normalized, nil, warnings
+}
@@ -0,0 +1,97 @@
+package split
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MaxAudioFade 拼接处音频淡出淡入的最大时长(秒)
+const MaxAudioFade = 2.0
+
+// joinSegments 将切割出的片段按顺序拼接为一个完整的输出文件
+// 视频流直接复制;audioFade > 0 时在每个拼接点对音频做淡出淡入,避免爆音
+// 前后片段的音频不重叠(不是 acrossfade 交叉淡化),否则音频会比直接复制的视频短,导致音画不同步
+func (s *Splitter) joinSegments(ctx context.Context, splitID string, segments []SegmentResult, audioFade float64) (*SegmentResult, error) {
+	parts := make([]string, 0, len(segments))
+	durations := make([]float64, 0, len(segments))
+	for _, segment := range segments {
+		if !segment.Success {
+			return nil, fmt.Errorf("片段 %d 切割失败,无法拼接", segment.SegmentIndex)
+		}
+		parts = append(parts, segment.OutputPath)
+
+		// 以实际文件时长为准,copy 模式下与请求的时间略有差异
+		duration := segment.Duration
+		if info, err := s.prober.Probe(ctx, segment.OutputPath); err == nil && info.Duration > 0 {
+			duration = info.Duration
+		}
+		durations = append(durations, duration)
+	}
+
+	outputFileName := fmt.Sprintf("%s_edited.mp4", splitID)
+	outputPath := filepath.Join(s.TaskDir(splitID), outputFileName)
+
+	var codecArgs []string
+	if filter := fadeDipFilter(durations, audioFade); filter != "" {
+		codecArgs = []string{"-c:v", "copy", "-af", filter, "-c:a", "aac"}
+	}
+
+	log.Printf("🔗 拼接 %d 个片段: %s", len(parts), outputFileName)
+	if err := s.concatFiles(ctx, parts, outputPath, codecArgs); err != nil {
+		os.Remove(outputPath)
+		return nil, err
+	}
+
+	total := 0.0
+	for _, duration := range durations {
+		total += duration
+	}
+
+	var fileSize int64
+	if fileInfo, err := os.Stat(outputPath); err == nil {
+		fileSize = fileInfo.Size()
+	}
+
+	log.Printf("✅ 拼接完成: %s (%.2f MB)", outputFileName, float64(fileSize)/(1024*1024))
+
+	return &SegmentResult{
+		Success:       true,
+		OutputPath:    outputPath,
+		Size:          fileSize,
+		Duration:      total,
+		StartTime:     0,
+		EndTime:       total,
+		FileName:      outputFileName,
+		OriginalStart: segments[0].OriginalStart,
+		OriginalEnd:   segments[len(segments)-1].OriginalEnd,
+	}, nil
+}
+
+// fadeDipFilter 生成拼接点淡出淡入的音频滤镜
+// 音量在每个拼接点前 fade 秒内线性降到 0,拼接点后 fade 秒内恢复,不改变音频总时长
+// 淡化时长不超过最短片段的一半
+func fadeDipFilter(durations []float64, fade float64) string {
+	if fade <= 0 || len(durations) < 2 {
+		return ""
+	}
+	for _, duration := range durations {
+		if duration/2 < fade {
+			fade = duration / 2
+		}
+	}
+	if fade < keyframeEpsilon {
+		return ""
+	}
+
+	var factors []string
+	offset := 0.0
+	for _, duration := range durations[:len(durations)-1] {
+		offset += duration
+		factors = append(factors, fmt.Sprintf("min(1,abs(t-%.3f)/%.3f)", offset, fade))
+	}
+	return fmt.Sprintf("volume=eval=frame:volume='%s'", strings.Join(factors, "*"))
+}
@@ -0,0 +1,362 @@
+package split
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 切割模式
+const (
+	ModeReencode = "reencode" // 完整重新编码(默认),切点精确
+	ModeCopy     = "copy"     // 流复制,切点对齐到最近的关键帧,无画质损失
+	ModeSmart    = "smart"    // 只重新编码切点处不完整的 GOP,其余部分流复制
+)
+
+// keyframeEpsilon 判断时间点与关键帧重合的容差(秒)
+const keyframeEpsilon = 0.001
+
+// IsValidMode 检查切割模式是否受支持,空字符串表示默认模式
+func IsValidMode(mode string) bool {
+	switch mode {
+	case "", ModeReencode, ModeCopy, ModeSmart:
+		return true
+	}
+	return false
+}
+
+// keyframeIndex 关键帧信息
+type keyframeIndex struct {
+	times   []float64 // 相对于视频流起点的关键帧时间(秒,升序)
+	codec   string    // 视频编码
+	pixFmt  string    // 像素格式
+	profile string    // 编码 profile
+	level   int       // 编码 level
+	width   int       // 视频宽度
+	height  int       // 视频高度
+}
+
+// loadKeyframes 读取输入文件的关键帧位置
+func (s *Splitter) loadKeyframes(ctx context.Context, inputPath string) (*keyframeIndex, error) {
+	info, err := s.prober.Probe(ctx, inputPath)
+	if err != nil {
+		return nil, err
+	}
+	if info.Video == nil {
+		return nil, fmt.Errorf("文件中没有视频流")
+	}
+
+	times, err := s.prober.Keyframes(ctx, inputPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// ffprobe 返回的是绝对时间戳,-ss 使用的是相对于文件起点的时间
+	for i := range times {
+		times[i] -= info.Video.StartTime
+		if times[i] < 0 {
+			times[i] = 0
+		}
+	}
+
+	return &keyframeIndex{
+		times:   times,
+		codec:   info.Video.Codec,
+		pixFmt:  info.Video.PixelFormat,
+		profile: info.Video.Profile,
+		level:   info.Video.Level,
+		width:   info.Video.Width,
+		height:  info.Video.Height,
+	}, nil
+}
+
+// nearest 返回离 t 最近的关键帧
+func (k *keyframeIndex) nearest(t float64) float64 {
+	i := sort.SearchFloat64s(k.times, t)
+	if i == 0 {
+		return k.times[0]
+	}
+	if i == len(k.times) {
+		return k.times[i-1]
+	}
+	if k.times[i]-t < t-k.times[i-1] {
+		return k.times[i]
+	}
+	return k.times[i-1]
+}
+
+// after 返回严格晚于 t 的第一个关键帧,不存在时返回 false
+func (k *keyframeIndex) after(t float64) (float64, bool) {
+	i := sort.SearchFloat64s(k.times, t+keyframeEpsilon)
+	if i == len(k.times) {
+		return 0, false
+	}
+	return k.times[i], true
+}
+
+// before 返回不晚于 t 的最后一个关键帧,不存在时返回 false
+func (k *keyframeIndex) before(t float64) (float64, bool) {
+	i := sort.SearchFloat64s(k.times, t+keyframeEpsilon)
+	if i == 0 {
+		return 0, false
+	}
+	return k.times[i-1], true
+}
+
+// snap 将片段的起止时间对齐到最近的关键帧(流复制模式)
+// 片段结束于视频末尾时不对齐结束时间
+func (k *keyframeIndex) snap(segment TimeInterval, videoDuration float64) TimeInterval {
+	start := k.nearest(segment.Start)
+	end := videoDuration
+	if segment.End < videoDuration-keyframeEpsilon {
+		end = k.nearest(segment.End)
+	}
+
+	// 片段短于一个 GOP 时,至少保留到下一个关键帧
+	if end <= start {
+		if next, ok := k.after(start); ok {
+			end = next
+		} else {
+			end = videoDuration
+		}
+	}
+	return TimeInterval{Start: start, End: end}
+}
+
+// smartParts 将片段拆分为 头部(重新编码)、中间(流复制)、尾部(重新编码) 三部分
+// 片段内没有完整 GOP 时返回 false,应整体重新编码
+func (k *keyframeIndex) smartParts(segment TimeInterval, videoDuration float64) (head, middle, tail TimeInterval, ok bool) {
+	i := sort.SearchFloat64s(k.times, segment.Start-keyframeEpsilon)
+	if i == len(k.times) {
+		return head, middle, tail, false
+	}
+	first := k.times[i]
+
+	last := segment.End
+	if segment.End < videoDuration-keyframeEpsilon {
+		j := sort.SearchFloat64s(k.times, segment.End+keyframeEpsilon) - 1
+		if j < 0 {
+			return head, middle, tail, false
+		}
+		last = k.times[j]
+	}
+
+	if last-first <= keyframeEpsilon {
+		return head, middle, tail, false
+	}
+
+	head = TimeInterval{Start: segment.Start, End: first}
+	middle = TimeInterval{Start: first, End: last}
+	tail = TimeInterval{Start: last, End: segment.End}
+	return head, middle, tail, true
+}
+
+// copySegment 以流复制方式切割片段,start 应位于关键帧
+func (s *Splitter) copySegment(ctx context.Context, inputPath, outputPath string, start, duration float64, muxer string, onProgress func(float64)) error {
+	args := []string{
+		"-ss", fmt.Sprintf("%.3f", start),
+		"-i", inputPath,
+		"-t", fmt.Sprintf("%.3f", duration),
+		"-map", "0:v:0",
+		"-map", "0:a?",
+		"-c", "copy",
+		"-avoid_negative_ts", "make_zero",
+		"-f", muxer,
+	}
+	if muxer == "mp4" {
+		args = append(args, "-movflags", "+faststart")
+	}
+	args = append(args, "-y", outputPath)
+
+	log.Printf("🎬 FFmpeg 命令: %s %s", s.ffmpegPath, strings.Join(args, " "))
+
+	if err := s.runFFmpeg(ctx, args, duration, onProgress); err != nil {
+		return fmt.Errorf("FFmpeg 执行失败: %v", err)
+	}
+	return nil
+}
+
+// reencodeBoundary 重新编码切点处不完整的 GOP
+// 使用与源文件相同的像素格式、profile 和 level,使参数集与流复制部分兼容
+func (s *Splitter) reencodeBoundary(ctx context.Context, inputPath, outputPath string, start, duration float64, keyframes *keyframeIndex, onProgress func(float64)) error {
+	args := []string{
+		"-ss", fmt.Sprintf("%.3f", start),
+		"-i", inputPath,
+		"-t", fmt.Sprintf("%.3f", duration),
+		"-map", "0:v:0",
+		"-map", "0:a?",
+		"-c:v", "libx264",
+		"-preset", "fast",
+		"-crf", "18",
+	}
+	if keyframes.pixFmt != "" {
+		args = append(args, "-pix_fmt", keyframes.pixFmt)
+	}
+	switch profile := strings.ToLower(keyframes.profile); profile {
+	case "baseline", "main", "high":
+		args = append(args, "-profile:v", profile)
+	case "constrained baseline":
+		// libx264 的 baseline 输出即为 Constrained Baseline
+		args = append(args, "-profile:v", "baseline")
+	}
+	if keyframes.level > 0 {
+		args = append(args, "-level:v", fmt.Sprintf("%.1f", float64(keyframes.level)/10))
+	}
+	args = append(args, "-c:a", "aac", "-f", "mpegts", "-y", outputPath)
+
+	log.Printf("🎬 FFmpeg 命令: %s %s", s.ffmpegPath, strings.Join(args, " "))
+
+	if err := s.runFFmpeg(ctx, args, duration, onProgress); err != nil {
+		return fmt.Errorf("FFmpeg 执行失败: %v", err)
+	}
+	return nil
+}
+
+// checkBoundary 检查重新编码的部分与源文件的 SPS 关键参数是否一致
+// MP4 的 avcC 只保存第一个参数集,profile/level/像素格式/分辨率不一致时严格的播放器会解码错误
+func (s *Splitter) checkBoundary(ctx context.Context, path string, keyframes *keyframeIndex) error {
+	info, err := s.prober.Probe(ctx, path)
+	if err != nil {
+		return err
+	}
+	video := info.Video
+	if video == nil {
+		return fmt.Errorf("重新编码的部分没有视频流")
+	}
+
+	switch {
+	case !strings.EqualFold(video.Profile, keyframes.profile):
+		return fmt.Errorf("profile 不一致: %s / 源文件 %s", video.Profile, keyframes.profile)
+	case video.Level != keyframes.level:
+		return fmt.Errorf("level 不一致: %d / 源文件 %d", video.Level, keyframes.level)
+	case video.PixelFormat != keyframes.pixFmt:
+		return fmt.Errorf("像素格式不一致: %s / 源文件 %s", video.PixelFormat, keyframes.pixFmt)
+	case video.Width != keyframes.width || video.Height != keyframes.height:
+		return fmt.Errorf("分辨率不一致: %dx%d / 源文件 %dx%d", video.Width, video.Height, keyframes.width, keyframes.height)
+	}
+	return nil
+}
+
+// smartSegment 智能切割:头尾不完整的 GOP 重新编码,中间部分流复制,最后无损拼接
+// 中间文件使用 MPEG-TS 封装,每个关键帧都带有参数集,拼接后不会花屏
+// 重新编码部分的参数集与源文件不兼容时,改为整体重新编码该片段
+func (s *Splitter) smartSegment(ctx context.Context, inputPath, outputPath string, segment TimeInterval, videoDuration float64, keyframes *keyframeIndex, onProgress func(float64)) error {
+	head, middle, tail, ok := keyframes.smartParts(segment, videoDuration)
+	if !ok {
+		log.Printf("ℹ️  片段 %.2fs - %.2fs 内没有完整的 GOP,整体重新编码", segment.Start, segment.End)
+		return s.splitSegment(ctx, inputPath, outputPath, segment.Start, segment.End-segment.Start, onProgress)
+	}
+
+	base := strings.TrimSuffix(outputPath, filepath.Ext(outputPath))
+	var parts []string
+	defer func() {
+		for _, part := range parts {
+			os.Remove(part)
+		}
+	}()
+
+	// 各部分的进度按时长折算到整个片段
+	total := segment.End - segment.Start
+	done := 0.0
+	partProgress := func(length float64) func(float64) {
+		offset := done
+		done += length
+		return func(percent float64) {
+			if onProgress != nil && total > 0 {
+				onProgress((offset + length*percent/100) / total * 100)
+			}
+		}
+	}
+
+	// 重新编码的部分需要与流复制部分的参数集兼容
+	reencode := func(part string, interval TimeInterval) (bool, error) {
+		length := interval.End - interval.Start
+		if err := s.reencodeBoundary(ctx, inputPath, part, interval.Start, length, keyframes, partProgress(length)); err != nil {
+			return false, err
+		}
+		if err := s.checkBoundary(ctx, part, keyframes); err != nil {
+			log.Printf("⚠️  片段 %.2fs - %.2fs 边界重新编码的参数与源文件不兼容(%v),整体重新编码", segment.Start, segment.End, err)
+			return false, nil
+		}
+		return true, nil
+	}
+	fallback := func() error {
+		return s.splitSegment(ctx, inputPath, outputPath, segment.Start, segment.End-segment.Start, onProgress)
+	}
+
+	if head.End-head.Start > keyframeEpsilon {
+		part := base + "_head.ts"
+		parts = append(parts, part)
+		compatible, err := reencode(part, head)
+		if err != nil {
+			return err
+		}
+		if !compatible {
+			return fallback()
+		}
+	}
+
+	part := base + "_middle.ts"
+	parts = append(parts, part)
+	if err := s.copySegment(ctx, inputPath, part, middle.Start, middle.End-middle.Start, "mpegts", partProgress(middle.End-middle.Start)); err != nil {
+		return err
+	}
+
+	if tail.End-tail.Start > keyframeEpsilon {
+		part := base + "_tail.ts"
+		parts = append(parts, part)
+		compatible, err := reencode(part, tail)
+		if err != nil {
+			return err
+		}
+		if !compatible {
+			return fallback()
+		}
+	}
+
+	return s.concatFiles(ctx, parts, outputPath, nil)
+}
+
+// concatFiles 使用 concat 分离器拼接多个文件
+// codecArgs 为空时所有流直接复制,否则使用 codecArgs 指定的编码参数
+func (s *Splitter) concatFiles(ctx context.Context, parts []string, outputPath string, codecArgs []string) error {
+	listPath := strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + "_concat.txt"
+	var list strings.Builder
+	for _, part := range parts {
+		absPath, err := filepath.Abs(part)
+		if err != nil {
+			return fmt.Errorf("解析文件路径失败: %v", err)
+		}
+		fmt.Fprintf(&list, "file '%s'\n", strings.ReplaceAll(absPath, "'", `'\''`))
+	}
+	if err := os.WriteFile(listPath, []byte(list.String()), 0644); err != nil {
+		return fmt.Errorf("写入拼接列表失败: %v", err)
+	}
+	defer os.Remove(listPath)
+
+	args := []string{
+		"-f", "concat",
+		"-safe", "0",
+		"-i", listPath,
+	}
+	if len(codecArgs) == 0 {
+		codecArgs = []string{"-c", "copy"}
+	}
+	args = append(args, codecArgs...)
+	args = append(args,
+		"-f", "mp4",
+		"-movflags", "+faststart",
+		"-y", outputPath,
+	)
+
+	log.Printf("🎬 FFmpeg 命令: %s %s", s.ffmpegPath, strings.Join(args, " "))
+
+	if err := s.runFFmpeg(ctx, args, 0, nil); err != nil {
+		return fmt.Errorf("拼接片段失败: %v", err)
+	}
+	return nil
+}
@@ -1,15 +1,20 @@
 package split
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 
 	"goalfy-mediaconverter/internal/gpu"
+	"goalfy-mediaconverter/internal/probe"
+	"goalfy-mediaconverter/internal/progress"
 )
 
 // TimeInterval 时间区间
@@ -20,10 +25,20 @@ type TimeInterval struct {
 
 // SplitRequest 切割请求
 type SplitRequest struct {
-	TaskID          string         `json:"taskId" binding:"required"`          // 任务ID
-	DeleteIntervals []TimeInterval `json:"deleteIntervals" binding:"required"` // 要删除的时间区间
-	VideoDuration   float64        `json:"videoDuration" binding:"required"`   // 视频总时长(秒)
-	InputPath       string         `json:"inputPath"`                          // 输入文件路径(由服务端设置,不从JSON接收)
+	TaskID          string         `json:"taskId" binding:"required"` // 任务ID
+	Strategy        string         `json:"strategy"`                  // 切割策略: delete(默认)、duration、size、scene、chapters
+	DeleteIntervals []TimeInterval `json:"deleteIntervals"`           // 要删除的时间区间(delete 策略)
+	SegmentDuration float64        `json:"segmentDuration"`           // 每段时长(秒,duration 策略)
+	MaxSizeMB       float64        `json:"maxSizeMB"`                 // 每段最大大小(MB,size 策略)
+	SceneThreshold  float64        `json:"sceneThreshold"`            // 场景切换阈值 0-1(scene 策略),默认 0.4
+	VideoDuration   float64        `json:"videoDuration"`             // 视频总时长(秒),可选,服务端会自行探测
+	Mode            string         `json:"mode"`                      // 切割模式: reencode(默认)、copy、smart
+	Join            bool           `json:"join"`                      // 是否将保留片段拼接为一个文件
+	AudioFade       float64        `json:"audioFade"`                 // 拼接处音频淡出淡入时长(秒),仅 join 时有效
+	Concurrency     int            `json:"concurrency"`               // 同时切割的片段数,0 表示使用服务端默认值
+	FailurePolicy   string         `json:"failurePolicy"`             // 片段失败策略: bestEffort(默认)、failFast
+	KeepSource      bool           `json:"keepSource"`                // 切割完成后保留源文件,默认移入回收站
+	InputPath       string         `json:"inputPath"`                 // 输入文件路径(由服务端设置,不从JSON接收)
 }
 
 // SegmentResult 片段结果
@@ -38,26 +53,58 @@ type SegmentResult struct {
 	FileName      string  `json:"fileName"`
 	OriginalStart float64 `json:"originalStart"`
 	OriginalEnd   float64 `json:"originalEnd"`
+	Title         string  `json:"title,omitempty"` // 章节标题(chapters 策略)
 }
 
 // SplitResponse 切割响应
 type SplitResponse struct {
-	Success       bool            `json:"success"`
-	TaskID        string          `json:"taskId,omitempty"`
-	TotalSegments int             `json:"totalSegments,omitempty"`
-	Segments      []SegmentResult `json:"segments,omitempty"`
-	Error         string          `json:"error,omitempty"`
+	Success             bool            `json:"success"`
+	TaskID              string          `json:"taskId,omitempty"`       // 切割任务ID
+	SourceTaskID        string          `json:"sourceTaskId,omitempty"` // 被切割的转换任务ID
+	Strategy            string          `json:"strategy,omitempty"`     // 切割策略
+	Mode                string          `json:"mode,omitempty"`         // 实际使用的切割模式
+	TotalSegments       int             `json:"totalSegments,omitempty"`
+	Segments            []SegmentResult `json:"segments,omitempty"`
+	Joined              *SegmentResult  `json:"joined,omitempty"`              // 拼接后的完整文件(join 时)
+	VideoDuration       float64         `json:"videoDuration,omitempty"`       // 实际使用的视频时长(秒)
+	NormalizedIntervals []TimeInterval  `json:"normalizedIntervals,omitempty"` // 合并、截断后的删除区间
+	IntervalErrors      []IntervalError `json:"intervalErrors,omitempty"`      // 被拒绝的删除区间
+	IntervalWarnings    []IntervalError `json:"intervalWarnings,omitempty"`    // 被截断的删除区间
+	Error               string          `json:"error,omitempty"`
+}
+
+// 片段失败策略
+const (
+	BestEffort = "bestEffort" // 继续切割其余片段,失败的片段标记为 success=false(默认)
+	FailFast   = "failFast"   // 任一片段失败立即取消其余片段,整个任务失败
+)
+
+// IsValidFailurePolicy 检查失败策略是否受支持,空字符串表示默认策略
+func IsValidFailurePolicy(policy string) bool {
+	return policy == "" || policy == BestEffort || policy == FailFast
+}
+
+// failurePolicyName 返回失败策略名称,空字符串视为默认策略
+func failurePolicyName(policy string) string {
+	if policy == "" {
+		return BestEffort
+	}
+	return policy
 }
 
 // Splitter 视频切割器
 type Splitter struct {
-	ffmpegPath string
-	outputDir  string
-	gpuConfig  *gpu.Config
+	ffmpegPath  string
+	outputDir   string
+	gpuConfig   *gpu.Config
+	prober      *probe.Prober
+	maxWorkers  int           // 单个切割任务同时处理的最大片段数
+	gpuSessions *gpu.Sessions // 与转换器共享的硬件编码会话限制器
 }
 
 // New 创建切割器
-func New(ffmpegPath, outputDir string) *Splitter {
+// maxWorkers 为单个切割任务同时处理的最大片段数,gpuSessions 为与转换器共享的硬件编码会话限制器
+func New(ffmpegPath, outputDir string, maxWorkers int, gpuSessions *gpu.Sessions) *Splitter {
 	// 自动检测 GPU 加速
 	detector := gpu.NewDetector(ffmpegPath)
 	gpuConfig := detector.DetectGPU()
@@ -70,14 +117,53 @@ func New(ffmpegPath, outputDir string) *Splitter {
 		}
 	}
 
+	if maxWorkers < 1 {
+		maxWorkers = 1
+	}
+
 	return &Splitter{
-		ffmpegPath: ffmpegPath,
-		outputDir:  outputDir,
-		gpuConfig:  gpuConfig,
+		ffmpegPath:  ffmpegPath,
+		outputDir:   outputDir,
+		gpuConfig:   gpuConfig,
+		prober:      probe.New(ffmpegPath),
+		maxWorkers:  maxWorkers,
+		gpuSessions: gpuSessions,
 	}
 }
 
+// workers 计算本次切割的并发数
+// requested 为请求指定的并发数(0 表示默认),不超过服务端上限和片段数
+func (s *Splitter) workers(requested, segments int) int {
+	workers := s.maxWorkers
+	if requested > 0 && requested < workers {
+		workers = requested
+	}
+	return max(min(workers, segments), 1)
+}
+
+// resolveDuration 确定视频时长
+// 以 ffprobe 探测结果为准,探测失败时才使用客户端提供的 videoDuration
+func (s *Splitter) resolveDuration(ctx context.Context, inputPath string, clientDuration float64) (float64, error) {
+	info, err := s.prober.Probe(ctx, inputPath)
+	if err == nil && info.Duration > 0 {
+		if clientDuration > 0 && math.Abs(clientDuration-info.Duration) > 0.5 {
+			log.Printf("⚠️  客户端提供的时长 %.3fs 与实际时长 %.3fs 不一致,使用实际时长", clientDuration, info.Duration)
+		}
+		return info.Duration, nil
+	}
+
+	if clientDuration > 0 {
+		log.Printf("⚠️  无法探测视频时长(%v),使用客户端提供的 %.3fs", err, clientDuration)
+		return clientDuration, nil
+	}
+	if err == nil {
+		err = fmt.Errorf("文件中没有时长信息")
+	}
+	return 0, fmt.Errorf("无法获取视频时长: %v", err)
+}
+
 // calculateRetainedSegments 计算保留的视频片段
+// deleteIntervals 应已经过 normalizeIntervals 规范化
 func calculateRetainedSegments(videoDuration float64, deleteIntervals []TimeInterval) []TimeInterval {
 	// 如果没有删除区间,保留整个视频
 	if len(deleteIntervals) == 0 {
@@ -126,7 +212,8 @@ func calculateRetainedSegments(videoDuration float64, deleteIntervals []TimeInte
 }
 
 // splitSegment 切割单个视频片段
-func (s *Splitter) splitSegment(inputPath, outputPath string, startTime, duration float64) error {
+// onProgress 接收该片段的完成百分比(0-100);ctx 取消时终止 FFmpeg 进程
+func (s *Splitter) splitSegment(ctx context.Context, inputPath, outputPath string, startTime, duration float64, onProgress func(float64)) error {
 	// 使用 GPU 配置构建完整的 FFmpeg 参数
 	// 注意: 对于 split 操作,-ss 需要特殊处理
 	var args []string
@@ -194,14 +281,19 @@ func (s *Splitter) splitSegment(inputPath, outputPath string, startTime, duratio
 
 	log.Printf("🎬 FFmpeg 命令: %s %s", s.ffmpegPath, strings.Join(args, " "))
 
-	cmd := exec.Command(s.ffmpegPath, args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	err := cmd.Run()
+	var err error
+	if s.gpuConfig.Enabled {
+		var release func()
+		if release, err = s.gpuSessions.Acquire(ctx, 1); err == nil {
+			err = s.runFFmpeg(ctx, args, duration, onProgress)
+			release()
+		}
+	} else {
+		err = s.runFFmpeg(ctx, args, duration, onProgress)
+	}
 
 	// 如果 GPU 失败且启用了回退,尝试 CPU 编码
-	if err != nil && s.gpuConfig.Enabled && s.gpuConfig.FallbackCPU {
+	if err != nil && ctx.Err() == nil && s.gpuConfig.Enabled && s.gpuConfig.FallbackCPU {
 		log.Printf("⚠️  GPU 编码失败: %v", err)
 		log.Println("🔄 尝试使用 CPU 编码...")
 
@@ -220,10 +312,7 @@ func (s *Splitter) splitSegment(inputPath, outputPath string, startTime, duratio
 			outputPath,
 		}
 
-		cmd = exec.Command(s.ffmpegPath, cpuArgs...)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		err = cmd.Run()
+		err = s.runFFmpeg(ctx, cpuArgs, duration, onProgress)
 	}
 
 	if err != nil {
@@ -233,146 +322,483 @@ func (s *Splitter) splitSegment(inputPath, outputPath string, startTime, duratio
 	return nil
 }
 
-// SplitVideo 执行视频切割任务
-func (s *Splitter) SplitVideo(req SplitRequest) (*SplitResponse, error) {
-	log.Printf("📹 开始视频切割任务: %s", req.TaskID)
+// runFFmpeg 执行 FFmpeg 并报告进度
+// duration 为本次输出的预期时长,用于计算百分比
+func (s *Splitter) runFFmpeg(ctx context.Context, args []string, duration float64, onProgress func(float64)) error {
+	// -progress 为全局参数,放在最前面
+	args = append(progress.Args(), args...)
+
+	cmd := exec.CommandContext(ctx, s.ffmpegPath, args...)
+	cmd.Stderr = os.Stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("创建 stdout 管道失败: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	progress.Parse(stdout, duration, func(p progress.Progress) {
+		if onProgress != nil {
+			onProgress(p.Percent)
+		}
+	})
+
+	return cmd.Wait()
+}
+
+// Plan 切割计划
+type Plan struct {
+	VideoDuration float64         `json:"videoDuration"`       // 实际使用的视频时长(秒)
+	Strategy      string          `json:"strategy"`            // 切割策略
+	Intervals     []TimeInterval  `json:"normalizedIntervals"` // 规范化后的删除区间
+	Warnings      []IntervalError `json:"intervalWarnings"`    // 被截断的删除区间
+	Segments      []TimeInterval  `json:"segments"`            // 要保留的片段(请求的时间),scene 策略在 Plan 之前为空
+	Titles        []string        `json:"titles,omitempty"`    // 片段标题(chapters 策略)
+	Mode          string          `json:"mode"`                // 实际使用的切割模式
+	Cuts          []TimeInterval  `json:"cuts"`                // 实际切割的时间,copy 模式下对齐到关键帧
+
+	keyframes  *keyframeIndex
+	sizeLength float64 // size 策略下单个片段的最大时长
+}
+
+// SplitProgress 切割进度
+type SplitProgress struct {
+	Segments []float64 // 每个片段的完成百分比
+	Overall  float64   // 按片段时长加权的总体百分比
+}
 
+// Validate 校验切割请求并计算片段
+// 只执行快速的检查,场景检测和关键帧读取等耗时步骤留给 Plan
+// 校验失败时返回的 SplitResponse 描述了失败原因(含逐个区间的错误)
+func (s *Splitter) Validate(ctx context.Context, req SplitRequest) (*Plan, *SplitResponse) {
 	// 1. 使用传入的文件路径
 	inputPath := req.InputPath
 	if inputPath == "" {
-		return &SplitResponse{
+		return nil, &SplitResponse{
 			Success: false,
 			Error:   "未提供输入文件路径",
-		}, nil
+		}
 	}
 
 	// 检查文件是否存在
 	if _, err := os.Stat(inputPath); os.IsNotExist(err) {
-		return &SplitResponse{
+		return nil, &SplitResponse{
 			Success: false,
 			Error:   fmt.Sprintf("视频文件不存在: %s", inputPath),
-		}, nil
+		}
 	}
 
-	log.Printf("✅ 找到源文件: %s", inputPath)
+	if !IsValidMode(req.Mode) {
+		return nil, &SplitResponse{
+			Success: false,
+			Error:   fmt.Sprintf("不支持的切割模式: %s", req.Mode),
+		}
+	}
+	if err := ValidateStrategy(req); err != nil {
+		return nil, &SplitResponse{
+			Success: false,
+			Error:   err.Error(),
+		}
+	}
 
-	// 2. 计算保留片段
-	retainedSegments := calculateRetainedSegments(req.VideoDuration, req.DeleteIntervals)
-	if len(retainedSegments) == 0 {
-		return &SplitResponse{
+	// 2. 确定视频时长
+	videoDuration, err := s.resolveDuration(ctx, inputPath, req.VideoDuration)
+	if err != nil {
+		return nil, &SplitResponse{
 			Success: false,
-			Error:   "没有要保留的视频片段",
-		}, nil
+			Error:   err.Error(),
+		}
 	}
 
-	log.Printf("📊 计算出 %d 个保留片段", len(retainedSegments))
+	plan := &Plan{
+		VideoDuration: videoDuration,
+		Strategy:      req.Strategy,
+		Mode:          req.Mode,
+	}
+	if plan.Strategy == "" {
+		plan.Strategy = StrategyDelete
+	}
+	if plan.Mode == "" {
+		plan.Mode = ModeReencode
+	}
 
-	// 3. 切割每个片段
-	segments := []SegmentResult{}
-	// 使用任务ID作为基础文件名
-	baseFileName := req.TaskID
+	// 3. 按策略计算片段
+	switch plan.Strategy {
+	case StrategyDelete:
+		intervals, intervalErrors, intervalWarnings := normalizeIntervals(videoDuration, req.DeleteIntervals)
+		if len(intervalErrors) > 0 {
+			return nil, &SplitResponse{
+				Success:          false,
+				VideoDuration:    videoDuration,
+				IntervalErrors:   intervalErrors,
+				IntervalWarnings: intervalWarnings,
+				Error:            fmt.Sprintf("%d 个删除区间无效", len(intervalErrors)),
+			}
+		}
+		plan.Intervals = intervals
+		plan.Warnings = intervalWarnings
+		plan.Segments = calculateRetainedSegments(videoDuration, intervals)
 
-	for i, segment := range retainedSegments {
-		segmentIndex := i + 1
-		duration := segment.End - segment.Start
+	case StrategyDuration:
+		plan.Segments = fixedSegments(videoDuration, req.SegmentDuration)
 
-		// 输出文件名: taskId_part1.mp4, taskId_part2.mp4, ...
-		outputFileName := fmt.Sprintf("%s_part%d.mp4", baseFileName, segmentIndex)
-		outputPath := filepath.Join(s.outputDir, outputFileName)
+	case StrategySize:
+		length, err := s.sizeSegmentDuration(ctx, inputPath, videoDuration, req.MaxSizeMB)
+		if err != nil {
+			return nil, &SplitResponse{
+				Success:       false,
+				VideoDuration: videoDuration,
+				Error:         err.Error(),
+			}
+		}
+		// 重新编码后的大小取决于编码参数,只有流复制能让片段大小与源文件码率一致
+		if plan.Mode != ModeCopy {
+			log.Printf("⚠️  按大小切割固定使用流复制,忽略切割模式 %s", plan.Mode)
+			plan.Mode = ModeCopy
+		}
+		plan.sizeLength = length
+		plan.Segments = fixedSegments(videoDuration, length)
 
-		log.Printf("🔪 切割片段 %d/%d: %.2fs - %.2fs (时长: %.2fs)",
-			segmentIndex, len(retainedSegments), segment.Start, segment.End, duration)
+	case StrategyChapters:
+		segments, titles, err := s.chapterSegments(ctx, inputPath, videoDuration)
+		if err != nil {
+			return nil, &SplitResponse{
+				Success:       false,
+				VideoDuration: videoDuration,
+				Error:         err.Error(),
+			}
+		}
+		plan.Segments = segments
+		plan.Titles = titles
 
-		// 执行切割
-		err := s.splitSegment(inputPath, outputPath, segment.Start, duration)
+	case StrategyScene:
+		// 场景检测需要解码整个视频,在 Plan 中执行
+		return plan, nil
+	}
+
+	if len(plan.Segments) == 0 {
+		return nil, &SplitResponse{
+			Success:             false,
+			VideoDuration:       videoDuration,
+			NormalizedIntervals: plan.Intervals,
+			IntervalWarnings:    plan.Warnings,
+			Error:               "没有要保留的视频片段",
+		}
+	}
+
+	return plan, nil
+}
+
+// Plan 校验切割请求并生成完整的切割计划
+// 在 Validate 的基础上执行场景检测,并为 copy / smart 模式读取关键帧
+func (s *Splitter) Plan(ctx context.Context, req SplitRequest) (*Plan, *SplitResponse) {
+	plan, failure := s.Validate(ctx, req)
+	if failure != nil {
+		return nil, failure
+	}
+	inputPath := req.InputPath
+	videoDuration := plan.VideoDuration
+
+	if plan.Strategy == StrategyScene {
+		points, err := s.detectScenes(ctx, inputPath, req.SceneThreshold)
 		if err != nil {
-			log.Printf("❌ 片段 %d 切割失败: %v", segmentIndex, err)
-			segments = append(segments, SegmentResult{
-				Success:      false,
-				SegmentIndex: segmentIndex,
+			return nil, &SplitResponse{
+				Success:       false,
+				VideoDuration: videoDuration,
+				Error:         err.Error(),
+			}
+		}
+		plan.Segments = pointSegments(videoDuration, points)
+	}
+	plan.Cuts = plan.Segments
+
+	// 4. copy / smart 模式需要关键帧位置
+	if plan.Mode == ModeCopy || plan.Mode == ModeSmart {
+		keyframes, err := s.loadKeyframes(ctx, inputPath)
+		if err != nil && plan.Strategy == StrategySize {
+			return nil, &SplitResponse{
+				Success:       false,
+				VideoDuration: videoDuration,
+				Error:         fmt.Sprintf("按大小切割需要读取关键帧: %v", err),
+			}
+		}
+		if err != nil {
+			log.Printf("⚠️  读取关键帧失败(%v),改为重新编码切割", err)
+			plan.Mode = ModeReencode
+		} else if plan.Mode == ModeSmart && keyframes.codec != "h264" {
+			log.Printf("⚠️  智能切割仅支持 H.264 源文件(当前为 %s),改为重新编码切割", keyframes.codec)
+			plan.Mode = ModeReencode
+		} else {
+			plan.keyframes = keyframes
+		}
+	}
+
+	// size 策略直接在关键帧处切割,片段时长不会因对齐而超出
+	if plan.Strategy == StrategySize {
+		plan.Segments = sizeSegments(plan.keyframes, videoDuration, plan.sizeLength)
+		plan.Cuts = plan.Segments
+	} else if plan.Mode == ModeCopy {
+		plan.Cuts = make([]TimeInterval, len(plan.Segments))
+		for i, segment := range plan.Segments {
+			plan.Cuts[i] = plan.keyframes.snap(segment, videoDuration)
+		}
+	}
+
+	return plan, nil
+}
+
+// cutSegment 按计划的切割模式生成单个片段
+func (s *Splitter) cutSegment(ctx context.Context, inputPath, outputPath string, plan *Plan, cut TimeInterval, onProgress func(float64)) error {
+	switch plan.Mode {
+	case ModeCopy:
+		return s.copySegment(ctx, inputPath, outputPath, cut.Start, cut.End-cut.Start, "mp4", onProgress)
+	case ModeSmart:
+		return s.smartSegment(ctx, inputPath, outputPath, cut, plan.VideoDuration, plan.keyframes, onProgress)
+	default:
+		return s.splitSegment(ctx, inputPath, outputPath, cut.Start, cut.End-cut.Start, onProgress)
+	}
+}
+
+// SplitVideo 按计划执行视频切割
+// 片段文件以 splitID 命名;ctx 取消时终止正在运行的 FFmpeg 并返回错误
+func (s *Splitter) SplitVideo(ctx context.Context, splitID string, req SplitRequest, plan *Plan, onProgress func(SplitProgress)) (*SplitResponse, error) {
+	log.Printf("📹 开始视频切割任务: %s (源任务 %s)", splitID, req.TaskID)
+
+	if err := os.MkdirAll(s.TaskDir(splitID), 0755); err != nil {
+		return nil, fmt.Errorf("创建任务目录失败: %v", err)
+	}
+
+	inputPath := req.InputPath
+	retainedSegments := plan.Segments
+	log.Printf("📊 计算出 %d 个保留片段,切割模式: %s", len(retainedSegments), plan.Mode)
+
+	// 进度按片段时长加权
+	totalDuration := 0.0
+	for _, segment := range retainedSegments {
+		totalDuration += segment.End - segment.Start
+	}
+	var progressMu sync.Mutex
+	state := SplitProgress{Segments: make([]float64, len(retainedSegments))}
+	report := func(i int, percent float64) {
+		progressMu.Lock()
+		defer progressMu.Unlock()
+
+		state.Segments[i] = percent
+		overall := 0.0
+		for j, segment := range retainedSegments {
+			overall += (segment.End - segment.Start) * state.Segments[j] / 100
+		}
+		if totalDuration > 0 {
+			state.Overall = overall / totalDuration * 100
+		}
+		if onProgress != nil {
+			onProgress(SplitProgress{
+				Segments: append([]float64(nil), state.Segments...),
+				Overall:  state.Overall,
 			})
-			continue
 		}
+	}
 
-		// 获取文件信息
-		fileInfo, err := os.Stat(outputPath)
-		var fileSize int64 = 0
-		if err == nil {
-			fileSize = fileInfo.Size()
+	failFast := req.FailurePolicy == FailFast
+	workers := s.workers(req.Concurrency, len(retainedSegments))
+	log.Printf("⚙️  并发切割: %d 个片段同时处理, 失败策略: %s", workers, failurePolicyName(req.FailurePolicy))
+
+	// fail-fast 时任一片段失败会取消其余片段
+	segmentCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// 切割每个片段,结果按片段顺序存放
+	segments := make([]SegmentResult, len(retainedSegments))
+	var (
+		wg       sync.WaitGroup
+		errMu    sync.Mutex
+		firstErr error
+	)
+	sem := make(chan struct{}, workers)
+
+dispatch:
+	for i := range retainedSegments {
+		select {
+		case sem <- struct{}{}:
+		case <-segmentCtx.Done():
+			break dispatch
 		}
 
-		log.Printf("✅ 片段 %d 切割成功: %s (%.2f MB)",
-			segmentIndex, outputFileName, float64(fileSize)/(1024*1024))
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
 
-		segments = append(segments, SegmentResult{
-			Success:       true,
-			OutputPath:    outputPath,
-			Size:          fileSize,
-			Duration:      duration,
-			StartTime:     segment.Start,
-			EndTime:       segment.End,
-			SegmentIndex:  segmentIndex,
-			FileName:      outputFileName,
-			OriginalStart: segment.Start,
-			OriginalEnd:   segment.End,
-		})
+			result, err := s.processSegment(segmentCtx, splitID, inputPath, plan, i, func(percent float64) {
+				report(i, percent)
+			})
+			segments[i] = result
+			if err != nil && segmentCtx.Err() == nil {
+				log.Printf("❌ 片段 %d 切割失败: %v", i+1, err)
+				errMu.Lock()
+				if firstErr == nil {
+					firstErr = fmt.Errorf("片段 %d 切割失败: %v", i+1, err)
+				}
+				errMu.Unlock()
+				if failFast {
+					cancel()
+				}
+				return
+			}
+			if err == nil {
+				report(i, 100)
+			}
+		}(i)
 	}
+	wg.Wait()
 
-	// 4. 删除原始完整文件(节省空间)
-	if _, err := os.Stat(inputPath); err == nil {
-		if err := os.Remove(inputPath); err != nil {
-			log.Printf("⚠️  删除原始文件失败: %v", err)
-		} else {
-			log.Printf("🗑️  已删除原始完整MP4文件")
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("切割任务已取消")
+	}
+	if failFast && firstErr != nil {
+		return nil, firstErr
+	}
+
+	// bestEffort 下没有任何片段成功时没有可用的输出,整个任务失败
+	succeeded := 0
+	for _, segment := range segments {
+		if segment.Success {
+			succeeded++
+		}
+	}
+	if succeeded == 0 {
+		return nil, fmt.Errorf("全部 %d 个片段切割失败: %v", len(segments), firstErr)
+	}
+
+	// 拼接为一个完整文件
+	var joined *SegmentResult
+	if req.Join {
+		var err error
+		joined, err = s.joinSegments(ctx, splitID, segments, req.AudioFade)
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("切割任务已取消")
+		}
+		if err != nil {
+			return nil, err
 		}
 	}
 
 	log.Printf("🎉 视频切割任务完成: %d 个片段", len(segments))
 
 	return &SplitResponse{
-		Success:       true,
-		TaskID:        req.TaskID,
-		TotalSegments: len(segments),
-		Segments:      segments,
+		Success:             true,
+		TaskID:              splitID,
+		SourceTaskID:        req.TaskID,
+		Strategy:            plan.Strategy,
+		Mode:                plan.Mode,
+		TotalSegments:       len(segments),
+		Segments:            segments,
+		Joined:              joined,
+		VideoDuration:       plan.VideoDuration,
+		NormalizedIntervals: plan.Intervals,
+		IntervalWarnings:    plan.Warnings,
 	}, nil
 }
 
-// FindSegmentFile 查找片段文件
-func (s *Splitter) FindSegmentFile(taskID string, segmentIndex int) (string, error) {
-	files, err := os.ReadDir(s.outputDir)
-	if err != nil {
-		return "", fmt.Errorf("读取输出目录失败: %v", err)
+// processSegment 切割第 i 个保留片段
+func (s *Splitter) processSegment(ctx context.Context, splitID, inputPath string, plan *Plan, i int, onProgress func(float64)) (SegmentResult, error) {
+	segmentIndex := i + 1
+	segment := plan.Segments[i]
+	cut := plan.Cuts[i]
+	title := ""
+	if i < len(plan.Titles) {
+		title = plan.Titles[i]
 	}
+	duration := cut.End - cut.Start
 
-	targetPattern := fmt.Sprintf("_part%d.mp4", segmentIndex)
-	for _, file := range files {
-		if strings.Contains(file.Name(), taskID) && strings.Contains(file.Name(), targetPattern) {
-			return filepath.Join(s.outputDir, file.Name()), nil
-		}
+	// 输出文件名: splitId_part1.mp4, splitId_part2.mp4, ...
+	outputFileName := fmt.Sprintf("%s_part%d.mp4", splitID, segmentIndex)
+	outputPath := filepath.Join(s.TaskDir(splitID), outputFileName)
+
+	log.Printf("🔪 切割片段 %d/%d: %.2fs - %.2fs (时长: %.2fs)",
+		segmentIndex, len(plan.Segments), cut.Start, cut.End, duration)
+
+	// 执行切割
+	if err := s.cutSegment(ctx, inputPath, outputPath, plan, cut, onProgress); err != nil {
+		return SegmentResult{Success: false, SegmentIndex: segmentIndex}, err
+	}
+
+	// 获取文件信息
+	fileInfo, err := os.Stat(outputPath)
+	var fileSize int64 = 0
+	if err == nil {
+		fileSize = fileInfo.Size()
 	}
 
-	return "", fmt.Errorf("未找到片段文件")
+	log.Printf("✅ 片段 %d 切割成功: %s (%.2f MB)",
+		segmentIndex, outputFileName, float64(fileSize)/(1024*1024))
+
+	return SegmentResult{
+		Success:       true,
+		OutputPath:    outputPath,
+		Size:          fileSize,
+		Duration:      duration,
+		StartTime:     cut.Start,
+		EndTime:       cut.End,
+		SegmentIndex:  segmentIndex,
+		FileName:      outputFileName,
+		OriginalStart: segment.Start,
+		OriginalEnd:   segment.End,
+		Title:         title,
+	}, nil
 }
 
-// CleanupSplitFiles 清理切割文件
-func (s *Splitter) CleanupSplitFiles(taskID string) (int, error) {
-	files, err := os.ReadDir(s.outputDir)
-	if err != nil {
-		return 0, fmt.Errorf("读取输出目录失败: %v", err)
+// UsesGPU 指定切割模式是否使用 GPU 硬件编码
+// copy 与 smart 模式不使用 GPU(smart 的边界部分需与源文件参数一致,使用 libx264)
+func (s *Splitter) UsesGPU(mode string) bool {
+	return s.gpuConfig.Enabled && (mode == "" || mode == ModeReencode)
+}
+
+// TaskDir 返回切割任务的输出子目录,每个任务的片段都保存在各自的目录中
+func (s *Splitter) TaskDir(splitID string) string {
+	return filepath.Join(s.outputDir, splitID)
+}
+
+// CleanupSplitFiles 清理切割任务的输出文件
+// 删除任务记录中的文件(paths)以及任务的输出子目录,返回删除的文件数
+func (s *Splitter) CleanupSplitFiles(taskID string, paths []string) (int, error) {
+	if taskID == "" || taskID == "." || taskID == ".." || filepath.Base(taskID) != taskID {
+		return 0, fmt.Errorf("无效的任务ID: %s", taskID)
 	}
 
 	count := 0
-	for _, file := range files {
-		if strings.Contains(file.Name(), taskID) && strings.Contains(file.Name(), "_part") && strings.HasSuffix(file.Name(), ".mp4") {
-			filePath := filepath.Join(s.outputDir, file.Name())
-			if err := os.Remove(filePath); err != nil {
-				log.Printf("⚠️  删除文件失败 %s: %v", file.Name(), err)
-			} else {
-				count++
-				log.Printf("🗑️  已删除: %s", file.Name())
-			}
+	for _, path := range paths {
+		// 只删除输出目录中的文件
+		if rel, err := filepath.Rel(s.outputDir, path); err != nil || strings.HasPrefix(rel, "..") {
+			continue
 		}
+		if err := os.Remove(path); err == nil {
+			count++
+			log.Printf("🗑️  已删除: %s", filepath.Base(path))
+		} else if !os.IsNotExist(err) {
+			log.Printf("⚠️  删除文件失败 %s: %v", filepath.Base(path), err)
+		}
+	}
+
+	dir := s.TaskDir(taskID)
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return count, nil
+	}
+	if err != nil {
+		return count, fmt.Errorf("读取任务目录失败: %v", err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			count++
+		}
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return count, fmt.Errorf("删除任务目录失败: %v", err)
 	}
+	log.Printf("🗑️  已删除任务目录: %s", dir)
 
 	return count, nil
 }
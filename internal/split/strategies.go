@@ -0,0 +1,202 @@
+package split
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os/exec"
+	"regexp"
+	"strconv"
+)
+
+// 切割策略
+const (
+	StrategyDelete   = "delete"   // 删除指定区间,保留其余部分(默认)
+	StrategyDuration = "duration" // 每 segmentDuration 秒切一段
+	StrategySize     = "size"     // 每段不超过 maxSizeMB
+	StrategyScene    = "scene"    // 在检测到的场景切换处切割
+	StrategyChapters = "chapters" // 按文件内嵌的章节切割
+)
+
+const (
+	// defaultSceneThreshold 默认场景切换阈值(0-1,越小越敏感)
+	defaultSceneThreshold = 0.4
+	// minSegmentDuration 自动切割时片段的最小时长(秒),更短的片段并入前一段
+	minSegmentDuration = 1.0
+	// sizeSafetyMargin 按大小切割时预留的余量,码率并不均匀
+	sizeSafetyMargin = 0.9
+)
+
+// showinfoPattern 匹配 showinfo 滤镜输出的帧时间
+var showinfoPattern = regexp.MustCompile(`Parsed_showinfo.*pts_time:\s*([0-9.]+)`)
+
+// ValidateStrategy 校验切割策略及其参数
+func ValidateStrategy(req SplitRequest) error {
+	switch req.Strategy {
+	case "", StrategyDelete:
+		if req.DeleteIntervals == nil {
+			return fmt.Errorf("deleteIntervals必须是数组")
+		}
+	case StrategyDuration:
+		if !(req.SegmentDuration >= minSegmentDuration) || math.IsInf(req.SegmentDuration, 0) {
+			return fmt.Errorf("segmentDuration 必须不小于 %.0f 秒", minSegmentDuration)
+		}
+	case StrategySize:
+		if !(req.MaxSizeMB > 0) || math.IsInf(req.MaxSizeMB, 0) {
+			return fmt.Errorf("maxSizeMB 必须大于 0")
+		}
+	case StrategyScene:
+		if req.SceneThreshold < 0 || req.SceneThreshold > 1 || math.IsNaN(req.SceneThreshold) {
+			return fmt.Errorf("sceneThreshold 必须在 0-1 之间")
+		}
+	case StrategyChapters:
+	default:
+		return fmt.Errorf("不支持的切割策略: %s", req.Strategy)
+	}
+	return nil
+}
+
+// fixedSegments 按固定时长切割
+// 末尾不足 minSegmentDuration 的部分并入前一段
+func fixedSegments(videoDuration, length float64) []TimeInterval {
+	var segments []TimeInterval
+	for start := 0.0; start < videoDuration; start += length {
+		end := math.Min(start+length, videoDuration)
+		if end-start < minSegmentDuration && len(segments) > 0 {
+			segments[len(segments)-1].End = end
+			break
+		}
+		segments = append(segments, TimeInterval{Start: start, End: end})
+	}
+	return segments
+}
+
+// pointSegments 按切割点切割
+// 与前一个切割点间隔不足 minSegmentDuration 的切割点被忽略
+func pointSegments(videoDuration float64, points []float64) []TimeInterval {
+	var segments []TimeInterval
+	start := 0.0
+	for _, point := range points {
+		if point-start < minSegmentDuration || videoDuration-point < minSegmentDuration {
+			continue
+		}
+		segments = append(segments, TimeInterval{Start: start, End: point})
+		start = point
+	}
+	return append(segments, TimeInterval{Start: start, End: videoDuration})
+}
+
+// sizeSegmentDuration 根据源文件平均码率估算不超过 maxSizeMB 的片段时长
+func (s *Splitter) sizeSegmentDuration(ctx context.Context, inputPath string, videoDuration, maxSizeMB float64) (float64, error) {
+	info, err := s.prober.Probe(ctx, inputPath)
+	if err != nil {
+		return 0, err
+	}
+	return sizeSegmentLength(info.BitRate, info.Size, videoDuration, maxSizeMB)
+}
+
+// sizeSegmentLength 计算按源文件码率流复制时不超过 maxSizeMB 的片段时长
+// bitRate 为源文件总码率(bps),未知时按文件大小和时长估算
+func sizeSegmentLength(bitRate, size int64, videoDuration, maxSizeMB float64) (float64, error) {
+	bytesPerSecond := float64(bitRate) / 8
+	if bytesPerSecond <= 0 && videoDuration > 0 {
+		bytesPerSecond = float64(size) / videoDuration
+	}
+	if bytesPerSecond <= 0 {
+		return 0, fmt.Errorf("无法获取视频码率")
+	}
+
+	length := maxSizeMB * 1024 * 1024 * sizeSafetyMargin / bytesPerSecond
+	if length < minSegmentDuration {
+		return 0, fmt.Errorf("maxSizeMB 过小: 视频码率约 %.2f MB/s", bytesPerSecond/(1024*1024))
+	}
+	return length, nil
+}
+
+// sizeSegments 在关键帧处切割出时长不超过 length 的片段(流复制)
+// 片段内容与源文件完全一致,大小随源文件码率;单个 GOP 长于 length 时该片段包含整个 GOP
+func sizeSegments(keyframes *keyframeIndex, videoDuration, length float64) []TimeInterval {
+	var segments []TimeInterval
+	start := 0.0
+	for videoDuration-start > length {
+		end, ok := keyframes.before(start + length)
+		if !ok || end <= start+keyframeEpsilon {
+			if end, ok = keyframes.after(start); !ok {
+				break
+			}
+		}
+		segments = append(segments, TimeInterval{Start: start, End: end})
+		start = end
+	}
+	return append(segments, TimeInterval{Start: start, End: videoDuration})
+}
+
+// chapterSegments 按章节切割
+func (s *Splitter) chapterSegments(ctx context.Context, inputPath string, videoDuration float64) ([]TimeInterval, []string, error) {
+	info, err := s.prober.Probe(ctx, inputPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var segments []TimeInterval
+	var titles []string
+	for _, chapter := range info.Chapters {
+		start := math.Max(chapter.Start, 0)
+		end := math.Min(chapter.End, videoDuration)
+		if end-start <= 0 {
+			continue
+		}
+		segments = append(segments, TimeInterval{Start: start, End: end})
+		titles = append(titles, chapter.Title)
+	}
+
+	if len(segments) == 0 {
+		return nil, nil, fmt.Errorf("文件中没有章节信息")
+	}
+	return segments, titles, nil
+}
+
+// detectScenes 使用 FFmpeg 场景检测找出场景切换的时间点
+func (s *Splitter) detectScenes(ctx context.Context, inputPath string, threshold float64) ([]float64, error) {
+	if threshold == 0 {
+		threshold = defaultSceneThreshold
+	}
+
+	log.Printf("🔍 检测场景切换 (阈值 %.2f): %s", threshold, inputPath)
+
+	cmd := exec.CommandContext(ctx, s.ffmpegPath,
+		"-hide_banner",
+		"-i", inputPath,
+		"-an", "-sn", "-dn",
+		"-vf", fmt.Sprintf("select='gt(scene,%.3f)',showinfo", threshold),
+		"-f", "null",
+		"-",
+	)
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("创建 stderr 管道失败: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("启动场景检测失败: %v", err)
+	}
+
+	var points []float64
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		if m := showinfoPattern.FindStringSubmatch(scanner.Text()); m != nil {
+			if t, err := strconv.ParseFloat(m[1], 64); err == nil {
+				points = append(points, t)
+			}
+		}
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return nil, fmt.Errorf("场景检测失败: %v", err)
+	}
+
+	log.Printf("🎞️  检测到 %d 个场景切换", len(points))
+	return points, nil
+}
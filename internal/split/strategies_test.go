@@ -0,0 +1,117 @@
+package split
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSizeSegmentLength(t *testing.T) {
+	tests := []struct {
+		name          string
+		bitRate       int64
+		size          int64
+		videoDuration float64
+		maxSizeMB     float64
+		want          float64
+		wantErr       bool
+	}{
+		{
+			name:          "按码率计算",
+			bitRate:       8 * 1024 * 1024, // 1 MB/s
+			videoDuration: 600,
+			maxSizeMB:     10,
+			want:          10 * sizeSafetyMargin,
+		},
+		{
+			name:          "码率未知时按文件大小估算",
+			size:          600 * 1024 * 1024,
+			videoDuration: 300, // 2 MB/s
+			maxSizeMB:     10,
+			want:          5 * sizeSafetyMargin,
+		},
+		{
+			name:          "码率与大小都未知",
+			videoDuration: 300,
+			maxSizeMB:     10,
+			wantErr:       true,
+		},
+		{
+			name:          "片段短于最小时长",
+			bitRate:       80 * 1024 * 1024, // 10 MB/s
+			videoDuration: 300,
+			maxSizeMB:     5,
+			wantErr:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sizeSegmentLength(tt.bitRate, tt.size, tt.videoDuration, tt.maxSizeMB)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("期望返回错误,实际得到 %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("意外的错误: %v", err)
+			}
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("片段时长 = %v, 期望 %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSizeSegments(t *testing.T) {
+	tests := []struct {
+		name          string
+		keyframes     []float64
+		videoDuration float64
+		length        float64
+		want          []TimeInterval
+	}{
+		{
+			name:          "在不超过时长的最后一个关键帧处切割",
+			keyframes:     []float64{0, 2, 4, 6, 8, 10, 12},
+			videoDuration: 13,
+			length:        5,
+			want:          []TimeInterval{{0, 4}, {4, 8}, {8, 13}},
+		},
+		{
+			name:          "关键帧恰好落在时长上",
+			keyframes:     []float64{0, 5, 10},
+			videoDuration: 12,
+			length:        5,
+			want:          []TimeInterval{{0, 5}, {5, 10}, {10, 12}},
+		},
+		{
+			name:          "GOP 长于片段时长时保留整个 GOP",
+			keyframes:     []float64{0, 10, 20},
+			videoDuration: 25,
+			length:        5,
+			want:          []TimeInterval{{0, 10}, {10, 20}, {20, 25}},
+		},
+		{
+			name:          "视频短于片段时长",
+			keyframes:     []float64{0, 2},
+			videoDuration: 3,
+			length:        5,
+			want:          []TimeInterval{{0, 3}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sizeSegments(&keyframeIndex{times: tt.keyframes}, tt.videoDuration, tt.length)
+			if len(got) != len(tt.want) {
+				t.Fatalf("片段 = %v, 期望 %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("片段 = %v, 期望 %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
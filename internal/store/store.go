@@ -0,0 +1,123 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Store 基于 JSON 文件的持久化存储
+// 每条记录保存为 <dir>/<bucket>/<id>.json,写入时先写临时文件再重命名,保证原子性
+type Store struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// New 创建存储,dir 不存在时自动创建
+func New(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建存储目录失败: %v", err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Put 保存记录
+func (s *Store) Put(bucket, id string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化记录失败: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bucketDir := filepath.Join(s.dir, bucket)
+	if err := os.MkdirAll(bucketDir, 0755); err != nil {
+		return fmt.Errorf("创建存储目录失败: %v", err)
+	}
+
+	path := s.recordPath(bucket, id)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("写入记录失败: %v", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("保存记录失败: %v", err)
+	}
+	return nil
+}
+
+// Delete 删除记录,记录不存在时不报错
+func (s *Store) Delete(bucket, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Remove(s.recordPath(bucket, id)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("删除记录失败: %v", err)
+	}
+	return nil
+}
+
+// Load 遍历 bucket 中的所有记录
+// 记录在锁内全部读出,解锁后再逐条回调,回调中可以调用 Put/Delete
+// 单条记录损坏时只记录日志并跳过,不影响其他记录的加载
+func (s *Store) Load(bucket string, fn func(id string, data []byte) error) error {
+	records, err := s.readAll(bucket)
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		if err := fn(record.id, record.data); err != nil {
+			log.Printf("⚠️  加载记录 %s/%s 失败: %v", bucket, record.id, err)
+		}
+	}
+	return nil
+}
+
+// record 从存储中读出的一条记录
+type record struct {
+	id   string
+	data []byte
+}
+
+// readAll 读出 bucket 中的所有记录
+func (s *Store) readAll(bucket string) ([]record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(filepath.Join(s.dir, bucket))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取存储目录失败: %v", err)
+	}
+
+	var records []record
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+
+		id := strings.TrimSuffix(name, ".json")
+		data, err := os.ReadFile(filepath.Join(s.dir, bucket, name))
+		if err != nil {
+			log.Printf("⚠️  读取记录 %s/%s 失败: %v", bucket, id, err)
+			continue
+		}
+		records = append(records, record{id: id, data: data})
+	}
+	return records, nil
+}
+
+// recordPath 获取记录文件路径
+func (s *Store) recordPath(bucket, id string) string {
+	return filepath.Join(s.dir, bucket, id+".json")
+}
@@ -0,0 +1,161 @@
+package task
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+)
+
+// Class 任务占用的编码资源类型
+type Class string
+
+const (
+	ClassGPU  Class = "gpu"  // GPU 硬件编码
+	ClassCPU  Class = "cpu"  // CPU 软件编码
+	ClassLive Class = "live" // 实时接收转换,单独预留工作槽,不与点播任务争抢
+)
+
+// Job 排队等待执行的作业
+type Job struct {
+	Task     *Task       // 关联的任务
+	Class    Class       // 资源类型,决定使用哪个并发上限
+	Priority int         // 优先级,数值越大越先执行,相同优先级按提交顺序
+	Run      func(*Task) // 执行函数,返回即视为作业结束
+}
+
+// queuedJob 队列中的作业
+type queuedJob struct {
+	Job
+	seq  uint64
+	stop func() bool // 取消对任务上下文的监听
+}
+
+// Queue 有界并发的任务队列
+// GPU、CPU 与实时接收作业分别排队,各自受并发上限约束
+type Queue struct {
+	mgr     *Manager
+	mu      sync.Mutex
+	limits  map[Class]int
+	running map[Class]int
+	pending map[Class][]*queuedJob
+	seq     uint64
+}
+
+// NewQueue 创建任务队列
+// gpuWorkers/cpuWorkers/liveWorkers 小于 1 时按 1 处理
+func NewQueue(mgr *Manager, gpuWorkers, cpuWorkers, liveWorkers int) *Queue {
+	return &Queue{
+		mgr: mgr,
+		limits: map[Class]int{
+			ClassGPU:  max(gpuWorkers, 1),
+			ClassCPU:  max(cpuWorkers, 1),
+			ClassLive: max(liveWorkers, 1),
+		},
+		running: make(map[Class]int),
+		pending: make(map[Class][]*queuedJob),
+	}
+}
+
+// Submit 提交作业,任务保持 pending 状态直到有空闲的工作槽
+func (q *Queue) Submit(job Job) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.seq++
+	qj := &queuedJob{Job: job, seq: q.seq}
+
+	// 排队期间任务被取消时立即移出队列
+	taskID := job.Task.ID
+	qj.stop = context.AfterFunc(job.Task.Context(), func() {
+		q.remove(taskID)
+	})
+
+	q.mgr.setPriority(taskID, job.Priority)
+	q.pending[job.Class] = append(q.pending[job.Class], qj)
+	q.sortPending(job.Class)
+
+	log.Printf("📥 任务 %s 已加入 %s 队列 (优先级 %d)", taskID, job.Class, job.Priority)
+	q.dispatch(job.Class)
+}
+
+// Stats 获取队列状态
+func (q *Queue) Stats() map[Class]map[string]int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	stats := make(map[Class]map[string]int)
+	for _, class := range []Class{ClassGPU, ClassCPU, ClassLive} {
+		stats[class] = map[string]int{
+			"limit":   q.limits[class],
+			"running": q.running[class],
+			"pending": len(q.pending[class]),
+		}
+	}
+	return stats
+}
+
+// remove 将任务移出等待队列
+func (q *Queue) remove(taskID string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for class, jobs := range q.pending {
+		for i, qj := range jobs {
+			if qj.Task.ID == taskID {
+				q.pending[class] = append(jobs[:i:i], jobs[i+1:]...)
+				log.Printf("🚫 任务 %s 已从队列中移除", taskID)
+				q.updatePositions(class)
+				return
+			}
+		}
+	}
+}
+
+// dispatch 在并发上限内启动等待中的作业,调用方需持有锁
+func (q *Queue) dispatch(class Class) {
+	for q.running[class] < q.limits[class] && len(q.pending[class]) > 0 {
+		qj := q.pending[class][0]
+		q.pending[class] = q.pending[class][1:]
+
+		qj.stop()
+		if qj.Task.Context().Err() != nil {
+			continue
+		}
+
+		q.running[class]++
+		q.mgr.setQueuePosition(qj.Task.ID, 0)
+		go q.run(qj)
+	}
+	q.updatePositions(class)
+}
+
+// run 执行作业,结束后释放工作槽并调度下一个作业
+func (q *Queue) run(qj *queuedJob) {
+	defer func() {
+		q.mu.Lock()
+		q.running[qj.Class]--
+		q.dispatch(qj.Class)
+		q.mu.Unlock()
+	}()
+
+	qj.Run(qj.Task)
+}
+
+// sortPending 按优先级降序、提交顺序升序排列,调用方需持有锁
+func (q *Queue) sortPending(class Class) {
+	jobs := q.pending[class]
+	sort.SliceStable(jobs, func(i, j int) bool {
+		if jobs[i].Priority != jobs[j].Priority {
+			return jobs[i].Priority > jobs[j].Priority
+		}
+		return jobs[i].seq < jobs[j].seq
+	})
+}
+
+// updatePositions 刷新等待中任务的队列位置(从 1 开始),调用方需持有锁
+func (q *Queue) updatePositions(class Class) {
+	for i, qj := range q.pending[class] {
+		q.mgr.setQueuePosition(qj.Task.ID, i+1)
+	}
+}
@@ -2,10 +2,15 @@ package task
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"log"
+	"math"
 	"sync"
 	"time"
 
+	"goalfy-mediaconverter/internal/store"
+
 	"github.com/google/uuid"
 )
 
@@ -13,63 +18,236 @@ import (
 type Status string
 
 const (
-	StatusPending    Status = "pending"    // 等待中
-	StatusProcessing Status = "processing" // 处理中
-	StatusCompleted  Status = "completed"  // 已完成
-	StatusFailed     Status = "failed"     // 失败
+	StatusPending     Status = "pending"     // 排队等待中
+	StatusProcessing  Status = "processing"  // 处理中
+	StatusCompleted   Status = "completed"   // 已完成
+	StatusFailed      Status = "failed"      // 失败
+	StatusInterrupted Status = "interrupted" // 服务重启时被中断,等待重新排队
+)
+
+// Type 任务类型
+type Type string
+
+const (
+	TypeConvert   Type = "convert"   // 格式转换
+	TypeSplit     Type = "split"     // 视频切割
+	TypeThumbnail Type = "thumbnail" // 缩略图生成
+	TypeAudio     Type = "audio"     // 音频提取
 )
 
+// Output 分段格式输出中可直接访问的入口文件(播放列表、清单)
+type Output struct {
+	Role     string `json:"role"`     // main: 任务的主入口;playlist: 其他播放列表;manifest: DASH 清单
+	Path     string `json:"path"`     // 文件路径
+	URL      string `json:"url"`      // 通过 /downloads 访问的地址,分片按相对路径加载
+	MIMEType string `json:"mimeType"` // Content-Type
+}
+
+// storeBucket 任务记录在持久化存储中的分组名
+const storeBucket = "tasks"
+
 // Task 转换任务
+// 由各处理模块定义的参数和结果以 JSON 保存,task 包不依赖这些模块,调用方通过 Decode 读取
 type Task struct {
-	ID           string     `json:"taskId"`                // 任务ID
-	Status       Status     `json:"status"`                // 状态
-	Progress     int        `json:"progress"`              // 进度 0-100
-	InputPath    string     `json:"inputPath"`             // 输入文件路径
-	OutputPath   string     `json:"outputPath"`            // 输出文件路径
-	OutputFormat string     `json:"outputFormat"`          // 输出格式
-	Quality      string     `json:"quality"`               // 质量
-	UploadID     string     `json:"uploadId,omitempty"`    // 关联的上传ID
-	Error        string     `json:"error,omitempty"`       // 错误信息
-	CreatedAt    time.Time  `json:"createdAt"`             // 创建时间
-	UpdatedAt    time.Time  `json:"updatedAt"`             // 更新时间
-	CompletedAt  *time.Time `json:"completedAt,omitempty"` // 完成时间
-	ctx          context.Context
-	cancel       context.CancelFunc
+	ID              string          `json:"taskId"`                    // 任务ID
+	Type            Type            `json:"type"`                      // 任务类型
+	Status          Status          `json:"status"`                    // 状态
+	Progress        int             `json:"progress"`                  // 进度 0-100
+	Duration        float64         `json:"duration,omitempty"`        // 输入媒体总时长(秒)
+	ProcessedTime   float64         `json:"processedTime,omitempty"`   // 已处理的媒体时长(秒)
+	FPS             float64         `json:"fps,omitempty"`             // 当前编码帧率
+	Speed           float64         `json:"speed,omitempty"`           // 编码速度倍数
+	ETA             float64         `json:"eta,omitempty"`             // 预计剩余时间(秒)
+	InputPath       string          `json:"inputPath"`                 // 输入文件路径
+	OutputPath      string          `json:"outputPath"`                // 输出文件路径
+	OutputFormat    string          `json:"outputFormat"`              // 输出格式
+	Outputs         []Output        `json:"outputs,omitempty"`         // 分段格式的播放列表等入口文件
+	Renditions      json.RawMessage `json:"renditions,omitempty"`      // 码率阶梯各档的转换结果
+	Quality         string          `json:"quality"`                   // 质量
+	Options         json.RawMessage `json:"options,omitempty"`         // 转换选项
+	Audio           json.RawMessage `json:"audio,omitempty"`           // 音频提取参数(音频任务)
+	Priority        int             `json:"priority,omitempty"`        // 排队优先级,越大越先执行
+	QueuePosition   int             `json:"queuePosition,omitempty"`   // 排队位置(从 1 开始),0 表示未在排队
+	UploadID        string          `json:"uploadId,omitempty"`        // 关联的上传ID
+	MediaInfo       json.RawMessage `json:"mediaInfo,omitempty"`       // 输出文件的媒体信息(转换完成后填充)
+	Sync            json.RawMessage `json:"sync,omitempty"`            // 转换前后测量的音画时间差
+	SourceTaskID    string          `json:"sourceTaskId,omitempty"`    // 切割任务对应的转换任务ID
+	Split           json.RawMessage `json:"split,omitempty"`           // 切割参数
+	Segments        json.RawMessage `json:"segments,omitempty"`        // 切割结果
+	SegmentProgress []int           `json:"segmentProgress,omitempty"` // 每个片段的进度 0-100
+	Thumbnail       json.RawMessage `json:"thumbnail,omitempty"`       // 缩略图参数(缩略图任务)
+	Thumbnails      json.RawMessage `json:"thumbnails,omitempty"`      // 缩略图结果
+	TrashedPath     string          `json:"trashedPath,omitempty"`     // 输出文件在回收站中的路径
+	TrashedAt       *time.Time      `json:"trashedAt,omitempty"`       // 输出文件移入回收站的时间
+	Error           string          `json:"error,omitempty"`           // 错误信息
+	CreatedAt       time.Time       `json:"createdAt"`                 // 创建时间
+	UpdatedAt       time.Time       `json:"updatedAt"`                 // 更新时间
+	CompletedAt     *time.Time      `json:"completedAt,omitempty"`     // 完成时间
+	ctx             context.Context
+	cancel          context.CancelFunc
+	revision        uint64 // 每次需要持久化的修改加一,用于丢弃乱序到达的旧快照
+}
+
+// EncodeProgress 编码进度快照,由调用方从 FFmpeg 进度转换而来
+type EncodeProgress struct {
+	Percent  float64 // 完成百分比 0-100
+	Duration float64 // 媒体总时长(秒)
+	OutTime  float64 // 已处理的媒体时长(秒)
+	FPS      float64 // 当前编码帧率
+	Speed    float64 // 编码速度倍数
+	ETA      float64 // 预计剩余时间(秒)
+}
+
+// Decode 将任务中以 JSON 保存的参数或结果解析为 T,raw 为空时返回 nil
+func Decode[T any](raw json.RawMessage) (*T, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	v := new(T)
+	if err := json.Unmarshal(raw, v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// encode 将参数或结果编码为 JSON,nil 值返回空
+func encode(v any) (json.RawMessage, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if string(data) == "null" {
+		return nil, nil
+	}
+	return data, nil
 }
 
 // Manager 任务管理器
 type Manager struct {
 	tasks map[string]*Task
 	mu    sync.RWMutex
+	store *store.Store // 持久化存储,为 nil 时仅保存在内存中
+
+	saveMu sync.Mutex        // 串行化存储写入,与 mu 分开,写盘时不阻塞任务读写
+	saved  map[string]uint64 // 每个任务已写入存储的版本
 }
 
 // NewManager 创建任务管理器
-func NewManager() *Manager {
-	return &Manager{
+// st 不为 nil 时从存储中恢复上次运行留下的任务记录
+func NewManager(st *store.Store) *Manager {
+	m := &Manager{
 		tasks: make(map[string]*Task),
+		store: st,
+		saved: make(map[string]uint64),
+	}
+	if st != nil {
+		m.load()
+	}
+	return m
+}
+
+// load 从存储中恢复任务
+// 重启前仍在等待或处理中的任务标记为 interrupted,由调用方决定是否重新排队
+func (m *Manager) load() {
+	err := m.store.Load(storeBucket, func(id string, data []byte) error {
+		task := &Task{}
+		if err := json.Unmarshal(data, task); err != nil {
+			return err
+		}
+
+		task.ctx, task.cancel = context.WithCancel(context.Background())
+		if task.Type == "" {
+			task.Type = TypeConvert
+		}
+		if task.Status == StatusPending || task.Status == StatusProcessing {
+			task.Status = StatusInterrupted
+			task.UpdatedAt = time.Now()
+			task.revision++
+			snapshot := *task
+			m.persist(&snapshot)
+		}
+
+		m.tasks[task.ID] = task
+		return nil
+	})
+	if err != nil {
+		log.Printf("⚠️  加载任务记录失败: %v", err)
+		return
+	}
+	log.Printf("📦 已恢复 %d 个任务记录", len(m.tasks))
+}
+
+// persist 保存任务快照,调用方不能持有 mu
+// 快照在锁内复制,并发修改的快照可能乱序到达,只写入比已保存版本更新的快照
+func (m *Manager) persist(snapshot *Task) {
+	if m.store == nil {
+		return
+	}
+
+	m.saveMu.Lock()
+	defer m.saveMu.Unlock()
+
+	if snapshot.revision <= m.saved[snapshot.ID] {
+		return
+	}
+	if err := m.store.Put(storeBucket, snapshot.ID, snapshot); err != nil {
+		log.Printf("⚠️  保存任务 %s 失败: %v", snapshot.ID, err)
+		return
 	}
+	m.saved[snapshot.ID] = snapshot.revision
+}
+
+// add 登记新任务并保存
+func (m *Manager) add(task *Task) {
+	m.mu.Lock()
+	task.revision = 1
+	m.tasks[task.ID] = task
+	snapshot := *task
+	m.mu.Unlock()
+
+	m.persist(&snapshot)
+}
+
+// update 持有锁修改任务,解锁后保存修改后的快照
+// 字段修改都整体替换切片和指针,浅拷贝的快照不会被后续修改影响
+func (m *Manager) update(id string, fn func(task *Task)) error {
+	m.mu.Lock()
+	task, ok := m.tasks[id]
+	if !ok {
+		m.mu.Unlock()
+		return fmt.Errorf("任务不存在: %s", id)
+	}
+
+	fn(task)
+	task.UpdatedAt = time.Now()
+	task.revision++
+	snapshot := *task
+	m.mu.Unlock()
+
+	m.persist(&snapshot)
+	return nil
 }
 
 // Create 创建新任务
 func (m *Manager) Create(inputPath, outputPath string) *Task {
-	return m.CreateWithOptions(inputPath, outputPath, "mp4", "medium", "")
+	return m.CreateWithOptions(inputPath, outputPath, "mp4", "", "", nil)
 }
 
 // CreateWithOptions 创建新任务(带完整选项)
-func (m *Manager) CreateWithOptions(inputPath, outputPath, outputFormat, quality, uploadID string) *Task {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
+// opts 为转换选项,保存后可通过 Decode 读取
+func (m *Manager) CreateWithOptions(inputPath, outputPath, outputFormat, uploadID, quality string, opts any) *Task {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	task := &Task{
 		ID:           uuid.New().String(),
+		Type:         TypeConvert,
 		Status:       StatusPending,
 		Progress:     0,
 		InputPath:    inputPath,
 		OutputPath:   outputPath,
 		OutputFormat: outputFormat,
 		Quality:      quality,
+		Options:      m.encodeParams(opts),
 		UploadID:     uploadID,
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
@@ -77,12 +255,121 @@ func (m *Manager) CreateWithOptions(inputPath, outputPath, outputFormat, quality
 		cancel:       cancel,
 	}
 
-	m.tasks[task.ID] = task
+	m.add(task)
 	return task
 }
 
-// MarkCompleted 标记任务完成
-func (m *Manager) MarkCompleted(id string) error {
+// CreateSplit 创建切割任务
+// 切割任务以转换任务的输出文件作为输入,req 为切割参数
+func (m *Manager) CreateSplit(source *Task, inputPath string, req any) *Task {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	task := &Task{
+		ID:           uuid.New().String(),
+		Type:         TypeSplit,
+		Status:       StatusPending,
+		InputPath:    inputPath,
+		OutputFormat: "mp4",
+		Quality:      source.Quality,
+		SourceTaskID: source.ID,
+		Split:        m.encodeParams(req),
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+
+	m.add(task)
+	return task
+}
+
+// CreateAudio 创建音频提取任务
+// sourceTaskID 为以转换任务输出作为输入时对应的转换任务ID,opts 为音频提取参数
+func (m *Manager) CreateAudio(inputPath, outputPath, outputFormat, uploadID, sourceTaskID string, opts any) *Task {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	task := &Task{
+		ID:           uuid.New().String(),
+		Type:         TypeAudio,
+		Status:       StatusPending,
+		InputPath:    inputPath,
+		OutputPath:   outputPath,
+		OutputFormat: outputFormat,
+		UploadID:     uploadID,
+		SourceTaskID: sourceTaskID,
+		Audio:        m.encodeParams(opts),
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+
+	m.add(task)
+	return task
+}
+
+// CreateThumbnail 创建缩略图任务
+// sourceTaskID 为以转换任务输出作为输入时对应的转换任务ID,opts 为缩略图参数
+func (m *Manager) CreateThumbnail(inputPath, outputFormat, uploadID, sourceTaskID string, opts any) *Task {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	task := &Task{
+		ID:           uuid.New().String(),
+		Type:         TypeThumbnail,
+		Status:       StatusPending,
+		InputPath:    inputPath,
+		OutputFormat: outputFormat,
+		UploadID:     uploadID,
+		SourceTaskID: sourceTaskID,
+		Thumbnail:    m.encodeParams(opts),
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+
+	m.add(task)
+	return task
+}
+
+// encodeParams 编码创建任务时的参数,参数均为普通结构体,编码失败只记录日志
+func (m *Manager) encodeParams(v any) json.RawMessage {
+	data, err := encode(v)
+	if err != nil {
+		log.Printf("⚠️  编码任务参数失败: %v", err)
+	}
+	return data
+}
+
+// UpdateThumbnailProgress 更新缩略图生成进度
+func (m *Manager) UpdateThumbnailProgress(id string, percent float64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task, ok := m.tasks[id]
+	if !ok {
+		return fmt.Errorf("任务不存在: %s", id)
+	}
+
+	task.Status = StatusProcessing
+	task.Progress = int(percent)
+	task.UpdatedAt = time.Now()
+	return nil
+}
+
+// SetThumbnails 记录缩略图结果
+func (m *Manager) SetThumbnails(id string, result any) error {
+	data, err := encode(result)
+	if err != nil {
+		return fmt.Errorf("编码缩略图结果失败: %v", err)
+	}
+	return m.update(id, func(task *Task) {
+		task.Thumbnails = data
+	})
+}
+
+// UpdateSplitProgress 更新切割任务的总体和逐片段进度
+func (m *Manager) UpdateSplitProgress(id string, overall float64, segments []float64) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -91,14 +378,47 @@ func (m *Manager) MarkCompleted(id string) error {
 		return fmt.Errorf("任务不存在: %s", id)
 	}
 
-	now := time.Now()
-	task.Status = StatusCompleted
-	task.Progress = 100
-	task.CompletedAt = &now
-	task.UpdatedAt = now
+	segmentProgress := make([]int, len(segments))
+	for i, percent := range segments {
+		segmentProgress[i] = int(percent)
+	}
+
+	task.Status = StatusProcessing
+	task.Progress = int(overall)
+	task.SegmentProgress = segmentProgress
+	task.UpdatedAt = time.Now()
 	return nil
 }
 
+// SetSplitResult 记录切割结果
+// 片段拼接为完整文件时 joinedPath 为该文件,作为任务的输出文件,可通过转换下载接口下载
+func (m *Manager) SetSplitResult(id string, segments any, joinedPath string) error {
+	data, err := encode(segments)
+	if err != nil {
+		return fmt.Errorf("编码切割结果失败: %v", err)
+	}
+	return m.update(id, func(task *Task) {
+		task.Segments = data
+		if joinedPath != "" {
+			task.OutputPath = joinedPath
+		}
+	})
+}
+
+// MarkCompleted 标记任务完成
+func (m *Manager) MarkCompleted(id string) error {
+	return m.update(id, func(task *Task) {
+		now := time.Now()
+		task.Status = StatusCompleted
+		task.Progress = 100
+		task.ETA = 0
+		if task.Duration > 0 {
+			task.ProcessedTime = task.Duration
+		}
+		task.CompletedAt = &now
+	})
+}
+
 // Get 获取任务
 func (m *Manager) Get(id string) (*Task, error) {
 	m.mu.RLock()
@@ -113,6 +433,14 @@ func (m *Manager) Get(id string) (*Task, error) {
 
 // UpdateStatus 更新任务状态
 func (m *Manager) UpdateStatus(id string, status Status, progress int) error {
+	return m.update(id, func(task *Task) {
+		task.Status = status
+		task.Progress = progress
+	})
+}
+
+// UpdateProgress 根据 FFmpeg 进度更新任务
+func (m *Manager) UpdateProgress(id string, p EncodeProgress) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -120,41 +448,153 @@ func (m *Manager) UpdateStatus(id string, status Status, progress int) error {
 	if !ok {
 		return fmt.Errorf("任务不存在: %s", id)
 	}
+	// 进度通道中可能残留结束前的快照,已完成或失败的任务不再回到处理中
+	if task.Status != StatusPending && task.Status != StatusProcessing {
+		return nil
+	}
 
-	task.Status = status
-	task.Progress = progress
+	task.Status = StatusProcessing
+	task.Progress = int(p.Percent)
+	task.Duration = p.Duration
+	task.ProcessedTime = p.OutTime
+	task.FPS = p.FPS
+	task.Speed = p.Speed
+	task.ETA = p.ETA
 	task.UpdatedAt = time.Now()
+	// 进度更新频繁且重启后会重新计算,不写入存储
 	return nil
 }
 
 // UpdateError 更新任务错误信息
 func (m *Manager) UpdateError(id string, err error) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	return m.update(id, func(task *Task) {
+		task.Status = StatusFailed
+		task.Error = err.Error()
+	})
+}
 
+// Delete 删除任务
+func (m *Manager) Delete(id string) error {
+	m.mu.Lock()
 	task, ok := m.tasks[id]
-	if !ok {
-		return fmt.Errorf("任务不存在: %s", id)
+	if ok && task.cancel != nil {
+		task.cancel()
 	}
+	delete(m.tasks, id)
+	m.mu.Unlock()
 
-	task.Status = StatusFailed
-	task.Error = err.Error()
-	task.UpdatedAt = time.Now()
+	if m.store == nil {
+		return nil
+	}
+
+	m.saveMu.Lock()
+	defer m.saveMu.Unlock()
+
+	// 删除前取出的快照可能稍后才到达,记为最大版本使其不再写入
+	m.saved[id] = math.MaxUint64
+	if err := m.store.Delete(storeBucket, id); err != nil {
+		log.Printf("⚠️  删除任务记录 %s 失败: %v", id, err)
+	}
 	return nil
 }
 
-// Delete 删除任务
-func (m *Manager) Delete(id string) error {
+// SetMediaInfo 记录输出文件的媒体信息
+func (m *Manager) SetMediaInfo(id string, info any) error {
+	data, err := encode(info)
+	if err != nil {
+		return fmt.Errorf("编码媒体信息失败: %v", err)
+	}
+	return m.update(id, func(task *Task) {
+		task.MediaInfo = data
+	})
+}
+
+// SetOutputPath 设置任务的输出路径,用于输出路径由任务 ID 决定的任务
+func (m *Manager) SetOutputPath(id, outputPath string) error {
+	return m.update(id, func(task *Task) {
+		task.OutputPath = outputPath
+	})
+}
+
+// SetOutputs 记录分段格式输出的入口文件
+func (m *Manager) SetOutputs(id string, outputs []Output) error {
+	return m.update(id, func(task *Task) {
+		task.Outputs = outputs
+	})
+}
+
+// SetRenditions 记录码率阶梯各档的转换结果
+func (m *Manager) SetRenditions(id string, renditions any) error {
+	data, err := encode(renditions)
+	if err != nil {
+		return fmt.Errorf("编码码率阶梯结果失败: %v", err)
+	}
+	return m.update(id, func(task *Task) {
+		task.Renditions = data
+	})
+}
+
+// SetSync 记录转换前后的音画同步测量结果
+func (m *Manager) SetSync(id string, report any) error {
+	data, err := encode(report)
+	if err != nil {
+		return fmt.Errorf("编码音画同步结果失败: %v", err)
+	}
+	return m.update(id, func(task *Task) {
+		task.Sync = data
+	})
+}
+
+// SetTrashed 记录输出文件已移入回收站,trashedPath 为空表示已恢复
+func (m *Manager) SetTrashed(id, trashedPath string) error {
+	return m.update(id, func(task *Task) {
+		task.TrashedPath = trashedPath
+		task.TrashedAt = nil
+		if trashedPath != "" {
+			now := time.Now()
+			task.TrashedAt = &now
+		}
+	})
+}
+
+// setQueuePosition 更新任务的排队位置
+func (m *Manager) setQueuePosition(id string, position int) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	if task, ok := m.tasks[id]; ok {
+		task.QueuePosition = position
+	}
+}
+
+// setPriority 记录任务的排队优先级,重新排队时沿用
+func (m *Manager) setPriority(id string, priority int) {
+	m.mu.Lock()
 	task, ok := m.tasks[id]
-	if ok && task.cancel != nil {
-		task.cancel()
+	if !ok || task.Priority == priority {
+		m.mu.Unlock()
+		return
 	}
+	task.Priority = priority
+	task.revision++
+	snapshot := *task
+	m.mu.Unlock()
 
-	delete(m.tasks, id)
-	return nil
+	m.persist(&snapshot)
+}
+
+// Interrupted 列出因服务重启而中断的任务
+func (m *Manager) Interrupted() []*Task {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var tasks []*Task
+	for _, task := range m.tasks {
+		if task.Status == StatusInterrupted {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks
 }
 
 // List 列出所有任务
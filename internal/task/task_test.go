@@ -0,0 +1,49 @@
+package task
+
+import (
+	"testing"
+	"time"
+
+	"goalfy-mediaconverter/internal/store"
+)
+
+func TestReloadMarksPendingInterrupted(t *testing.T) {
+	st, err := store.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("创建存储失败: %v", err)
+	}
+
+	pending := NewManager(st).CreateWithOptions("in.webm", "out.mp4", "mp4", "", "high", nil)
+
+	reloaded := make(chan *Manager, 1)
+	go func() {
+		reloaded <- NewManager(st)
+	}()
+
+	var m *Manager
+	select {
+	case m = <-reloaded:
+	case <-time.After(3 * time.Second):
+		t.Fatal("重新加载等待中的任务时死锁")
+	}
+
+	got, err := m.Get(pending.ID)
+	if err != nil {
+		t.Fatalf("任务未恢复: %v", err)
+	}
+	if got.Status != StatusInterrupted {
+		t.Fatalf("任务状态 = %s, 期望 %s", got.Status, StatusInterrupted)
+	}
+	if interrupted := m.Interrupted(); len(interrupted) != 1 || interrupted[0].ID != pending.ID {
+		t.Fatalf("中断任务 = %v, 期望只有 %s", interrupted, pending.ID)
+	}
+
+	// 标记为中断的状态已写回存储,再次加载时保持不变
+	again, err := NewManager(st).Get(pending.ID)
+	if err != nil {
+		t.Fatalf("任务未恢复: %v", err)
+	}
+	if again.Status != StatusInterrupted {
+		t.Fatalf("再次加载后任务状态 = %s, 期望 %s", again.Status, StatusInterrupted)
+	}
+}
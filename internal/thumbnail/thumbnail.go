@@ -0,0 +1,444 @@
+package thumbnail
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"goalfy-mediaconverter/internal/ffmpeg"
+	"goalfy-mediaconverter/internal/probe"
+	"goalfy-mediaconverter/internal/progress"
+)
+
+// 图片格式
+const (
+	FormatJPG = "jpg"
+	FormatPNG = "png"
+)
+
+// 默认参数与上限
+const (
+	defaultWidth         = 320 // 缩略图默认宽度
+	defaultSpriteWidth   = 160 // 雪碧图每格默认宽度
+	defaultSpriteColumns = 10  // 雪碧图每行默认格数
+	maxCount             = 100 // 缩略图最大数量
+	maxSpriteTiles       = 400 // 雪碧图最大格数,超出时自动加大间隔
+	autoSpriteTiles      = 100 // 未指定间隔时雪碧图的目标格数
+)
+
+// blackThreshold 平均亮度(YAVG,8 位)低于该值的帧视为黑帧
+// 有限范围视频的纯黑为 16,留出余量以排除淡入前的暗场
+const blackThreshold = 32
+
+// posterCandidates 自动选择封面时依次检查的时间点(占总时长的比例)
+var posterCandidates = []float64{0.05, 0.1, 0.2, 0.3, 0.4, 0.5}
+
+// Options 缩略图参数
+type Options struct {
+	Poster         bool     `json:"poster,omitempty"`         // 生成封面图
+	PosterTime     *float64 `json:"posterTime,omitempty"`     // 封面时间点(秒),不指定时自动选择非黑帧
+	Count          int      `json:"count,omitempty"`          // 均匀分布的缩略图数量,0 表示不生成
+	Width          int      `json:"width,omitempty"`          // 缩略图宽度,默认 320;封面默认保持原始尺寸
+	Format         string   `json:"format,omitempty"`         // 图片格式 jpg(默认)/png
+	Sprite         bool     `json:"sprite,omitempty"`         // 生成雪碧图和 WebVTT 缩略图轨道
+	SpriteInterval float64  `json:"spriteInterval,omitempty"` // 雪碧图每格间隔(秒),默认按时长自动计算
+	SpriteColumns  int      `json:"spriteColumns,omitempty"`  // 雪碧图每行格数,默认 10
+	SpriteWidth    int      `json:"spriteWidth,omitempty"`    // 雪碧图每格宽度,默认 160
+}
+
+// Validate 校验并规范化参数,返回的错误信息可直接返回给客户端
+func (o *Options) Validate() error {
+	if !o.Poster && o.Count == 0 && !o.Sprite {
+		return fmt.Errorf("至少需要指定 poster、count 或 sprite 之一")
+	}
+
+	if o.Format == "" {
+		o.Format = FormatJPG
+	}
+	o.Format = strings.ToLower(o.Format)
+	if o.Format == "jpeg" {
+		o.Format = FormatJPG
+	}
+	if o.Format != FormatJPG && o.Format != FormatPNG {
+		return fmt.Errorf("不支持的图片格式: %s (可选 jpg/png)", o.Format)
+	}
+
+	if o.PosterTime != nil {
+		if *o.PosterTime < 0 {
+			return fmt.Errorf("posterTime 不能为负数")
+		}
+		o.Poster = true
+	}
+	if o.Count < 0 || o.Count > maxCount {
+		return fmt.Errorf("count 超出范围: %d (0-%d)", o.Count, maxCount)
+	}
+	if o.Width != 0 && (o.Width < 16 || o.Width > 3840 || o.Width%2 != 0) {
+		return fmt.Errorf("无效的 width: %d (16-3840 的偶数)", o.Width)
+	}
+	if o.SpriteInterval != 0 && (o.SpriteInterval < 0.5 || o.SpriteInterval > 3600) {
+		return fmt.Errorf("spriteInterval 超出范围: %g (0.5-3600 秒)", o.SpriteInterval)
+	}
+	if o.SpriteColumns != 0 && (o.SpriteColumns < 1 || o.SpriteColumns > 20) {
+		return fmt.Errorf("spriteColumns 超出范围: %d (1-20)", o.SpriteColumns)
+	}
+	if o.SpriteWidth != 0 && (o.SpriteWidth < 32 || o.SpriteWidth > 640 || o.SpriteWidth%2 != 0) {
+		return fmt.Errorf("无效的 spriteWidth: %d (32-640 的偶数)", o.SpriteWidth)
+	}
+	return nil
+}
+
+// Image 生成的单张图片
+type Image struct {
+	Time float64 `json:"time"`          // 截取的时间点(秒)
+	Path string  `json:"path"`          // 文件路径
+	URL  string  `json:"url,omitempty"` // 通过 /downloads 访问的地址
+}
+
+// Sprite 雪碧图和对应的 WebVTT 缩略图轨道
+type Sprite struct {
+	Path       string  `json:"path"`             // 雪碧图路径
+	URL        string  `json:"url,omitempty"`    // 雪碧图地址
+	VTTPath    string  `json:"vttPath"`          // WebVTT 文件路径
+	VTTURL     string  `json:"vttUrl,omitempty"` // WebVTT 文件地址,可作为播放器的缩略图轨道
+	Interval   float64 `json:"interval"`         // 每格间隔(秒)
+	Tiles      int     `json:"tiles"`            // 格数
+	Columns    int     `json:"columns"`          // 每行格数
+	Rows       int     `json:"rows"`             // 行数
+	TileWidth  int     `json:"tileWidth"`        // 每格宽度
+	TileHeight int     `json:"tileHeight"`       // 每格高度
+}
+
+// Result 缩略图生成结果
+type Result struct {
+	Poster     *Image  `json:"poster,omitempty"`     // 封面图
+	Thumbnails []Image `json:"thumbnails,omitempty"` // 均匀分布的缩略图
+	Sprite     *Sprite `json:"sprite,omitempty"`     // 雪碧图
+	Error      string  `json:"error,omitempty"`      // 作为转换选项生成失败时的错误信息(不影响转换结果)
+}
+
+// SetURLs 根据文件路径填充访问地址
+func (r *Result) SetURLs(urlFor func(path string) string) {
+	if r.Poster != nil {
+		r.Poster.URL = urlFor(r.Poster.Path)
+	}
+	for i := range r.Thumbnails {
+		r.Thumbnails[i].URL = urlFor(r.Thumbnails[i].Path)
+	}
+	if r.Sprite != nil {
+		r.Sprite.URL = urlFor(r.Sprite.Path)
+		r.Sprite.VTTURL = urlFor(r.Sprite.VTTPath)
+	}
+}
+
+// Generator 缩略图生成器
+type Generator struct {
+	ffmpegPath string
+	prober     *probe.Prober
+}
+
+// New 创建缩略图生成器
+func New(ffmpegPath string) *Generator {
+	return &Generator{
+		ffmpegPath: ffmpegPath,
+		prober:     probe.New(ffmpegPath),
+	}
+}
+
+// Generate 按参数生成封面、缩略图和雪碧图,输出到 dir
+// onProgress 报告总体完成百分比 0-100
+func (g *Generator) Generate(ctx context.Context, inputPath, dir string, opts Options, onProgress func(float64)) (*Result, error) {
+	info, err := g.prober.Probe(ctx, inputPath)
+	if err != nil {
+		return nil, fmt.Errorf("获取媒体信息失败: %v", err)
+	}
+	if info.Video == nil {
+		return nil, fmt.Errorf("输入文件没有视频流,无法生成缩略图")
+	}
+	if info.Duration <= 0 {
+		return nil, fmt.Errorf("无法获取视频时长")
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建缩略图目录失败: %v", err)
+	}
+
+	// 按阶段平均分配进度
+	var stages []func(report func(float64)) error
+	result := &Result{}
+	ext := "." + opts.Format
+
+	if opts.Poster {
+		stages = append(stages, func(report func(float64)) error {
+			at, err := g.posterTime(ctx, inputPath, info.Duration, opts.PosterTime)
+			if err != nil {
+				return err
+			}
+			path := filepath.Join(dir, "poster"+ext)
+			if err := g.extractFrame(ctx, inputPath, path, at, opts.Width); err != nil {
+				return fmt.Errorf("生成封面失败: %v", err)
+			}
+			result.Poster = &Image{Time: at, Path: path}
+			return nil
+		})
+	}
+
+	if opts.Count > 0 {
+		stages = append(stages, func(report func(float64)) error {
+			width := opts.Width
+			if width == 0 {
+				width = defaultWidth
+			}
+			for i := 0; i < opts.Count; i++ {
+				at := info.Duration * (float64(i) + 0.5) / float64(opts.Count)
+				path := filepath.Join(dir, fmt.Sprintf("thumb_%03d%s", i+1, ext))
+				if err := g.extractFrame(ctx, inputPath, path, at, width); err != nil {
+					return fmt.Errorf("生成第 %d 张缩略图失败: %v", i+1, err)
+				}
+				result.Thumbnails = append(result.Thumbnails, Image{Time: roundTime(at), Path: path})
+				report(float64(i+1) / float64(opts.Count) * 100)
+			}
+			return nil
+		})
+	}
+
+	if opts.Sprite {
+		stages = append(stages, func(report func(float64)) error {
+			sprite, err := g.sprite(ctx, inputPath, dir, ext, info, opts, report)
+			if err != nil {
+				return err
+			}
+			result.Sprite = sprite
+			return nil
+		})
+	}
+
+	for i, stage := range stages {
+		report := func(percent float64) {
+			if onProgress != nil {
+				onProgress((float64(i) + percent/100) / float64(len(stages)) * 100)
+			}
+		}
+		if err := stage(report); err != nil {
+			return nil, err
+		}
+		report(100)
+	}
+
+	log.Printf("🖼️  缩略图生成完成: %s", dir)
+	return result, nil
+}
+
+// posterTime 确定封面时间点
+// 指定时间时直接使用;未指定时依次检查候选时间点,取第一个非黑帧,全部为黑帧时取最亮的一帧
+func (g *Generator) posterTime(ctx context.Context, inputPath string, duration float64, requested *float64) (float64, error) {
+	if requested != nil {
+		if *requested >= duration {
+			return 0, fmt.Errorf("posterTime %.3f 超出视频时长 %.3f 秒", *requested, duration)
+		}
+		return *requested, nil
+	}
+
+	best, bestLuma := 0.0, -1.0
+	for _, fraction := range posterCandidates {
+		at := roundTime(duration * fraction)
+		luma, err := g.frameLuma(ctx, inputPath, at)
+		if err != nil {
+			if ctx.Err() != nil {
+				return 0, ctx.Err()
+			}
+			log.Printf("⚠️  检测 %.3fs 处画面亮度失败: %v", at, err)
+			continue
+		}
+		if luma >= blackThreshold {
+			log.Printf("🖼️  自动选择封面: %.3fs (平均亮度 %.1f)", at, luma)
+			return at, nil
+		}
+		if luma > bestLuma {
+			best, bestLuma = at, luma
+		}
+	}
+
+	log.Printf("⚠️  候选时间点均为黑帧,使用最亮的一帧: %.3fs", best)
+	return best, nil
+}
+
+// frameLuma 使用 signalstats 测量指定时间点画面的平均亮度(YAVG)
+func (g *Generator) frameLuma(ctx context.Context, inputPath string, at float64) (float64, error) {
+	cmd := exec.CommandContext(ctx, g.ffmpegPath,
+		"-hide_banner",
+		"-ss", formatSeconds(at),
+		"-i", inputPath,
+		"-frames:v", "1",
+		"-an", "-sn", "-dn",
+		"-vf", "signalstats,metadata=print:key=lavfi.signalstats.YAVG:file=-",
+		"-f", "null",
+		"-",
+	)
+	stderr := ffmpeg.NewTailBuffer()
+	cmd.Stderr = stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("%v\nFFmpeg 输出:\n%s", err, stderr.String())
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), "lavfi.signalstats.YAVG="); ok {
+			return strconv.ParseFloat(value, 64)
+		}
+	}
+	return 0, fmt.Errorf("FFmpeg 输出中没有亮度信息")
+}
+
+// extractFrame 截取一帧保存为图片,width 为 0 时保持原始尺寸
+func (g *Generator) extractFrame(ctx context.Context, inputPath, outputPath string, at float64, width int) error {
+	args := []string{
+		"-hide_banner",
+		"-ss", formatSeconds(at),
+		"-i", inputPath,
+		"-frames:v", "1",
+		"-an", "-sn", "-dn",
+	}
+	if width > 0 {
+		args = append(args, "-vf", fmt.Sprintf("scale=%d:-2", width))
+	}
+	args = append(args, imageArgs(outputPath)...)
+	args = append(args, "-update", "1", "-y", outputPath)
+
+	cmd := exec.CommandContext(ctx, g.ffmpegPath, args...)
+	stderr := ffmpeg.NewTailBuffer()
+	cmd.Stderr = stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%v\nFFmpeg 输出:\n%s", err, stderr.String())
+	}
+	if _, err := os.Stat(outputPath); err != nil {
+		// 时间点落在最后一帧之后时 FFmpeg 不报错也不输出
+		return fmt.Errorf("%.3fs 处没有可截取的画面", at)
+	}
+	return nil
+}
+
+// sprite 生成雪碧图和 WebVTT 缩略图轨道
+// 一次解码整个文件,按间隔取帧缩放后用 tile 滤镜拼接为一张图
+func (g *Generator) sprite(ctx context.Context, inputPath, dir, ext string, info *probe.MediaInfo, opts Options, report func(float64)) (*Sprite, error) {
+	interval := opts.SpriteInterval
+	if interval == 0 {
+		interval = max(math.Ceil(info.Duration/autoSpriteTiles), 1)
+	}
+	if tiles := math.Ceil(info.Duration / interval); tiles > maxSpriteTiles {
+		adjusted := math.Ceil(info.Duration / maxSpriteTiles)
+		log.Printf("⚠️  雪碧图间隔 %gs 会生成 %.0f 格,超过上限 %d,改为 %gs", interval, tiles, maxSpriteTiles, adjusted)
+		interval = adjusted
+	}
+	tiles := max(int(math.Ceil(info.Duration/interval)), 1)
+
+	columns := opts.SpriteColumns
+	if columns == 0 {
+		columns = defaultSpriteColumns
+	}
+	columns = min(columns, tiles)
+	rows := (tiles + columns - 1) / columns
+
+	// 每格尺寸固定,WebVTT 中的坐标按此计算
+	tileWidth := opts.SpriteWidth
+	if tileWidth == 0 {
+		tileWidth = defaultSpriteWidth
+	}
+	sourceWidth, sourceHeight := info.Video.Width, info.Video.Height
+	if info.Video.Rotation == 90 || info.Video.Rotation == 270 {
+		sourceWidth, sourceHeight = sourceHeight, sourceWidth
+	}
+	tileHeight := tileWidth * 9 / 16
+	if sourceWidth > 0 && sourceHeight > 0 {
+		tileHeight = int(math.Round(float64(tileWidth)*float64(sourceHeight)/float64(sourceWidth)/2)) * 2
+	}
+	tileHeight = max(tileHeight, 2)
+
+	spritePath := filepath.Join(dir, "sprite"+ext)
+	filter := fmt.Sprintf("fps=1/%s,scale=%d:%d,tile=%dx%d",
+		formatSeconds(interval), tileWidth, tileHeight, columns, rows)
+
+	args := append(progress.Args(),
+		"-hide_banner",
+		"-i", inputPath,
+		"-an", "-sn", "-dn",
+		"-vf", filter,
+		"-frames:v", "1",
+	)
+	args = append(args, imageArgs(spritePath)...)
+	args = append(args, "-update", "1", "-y", spritePath)
+
+	err := ffmpeg.RunWithProgress(ctx, g.ffmpegPath, args, info.Duration, func(p progress.Progress) {
+		report(p.Percent)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("生成雪碧图失败: %v", err)
+	}
+
+	vttPath := filepath.Join(dir, "sprite.vtt")
+	if err := writeVTT(vttPath, filepath.Base(spritePath), info.Duration, interval, tiles, columns, tileWidth, tileHeight); err != nil {
+		return nil, fmt.Errorf("生成 WebVTT 失败: %v", err)
+	}
+
+	return &Sprite{
+		Path:       spritePath,
+		VTTPath:    vttPath,
+		Interval:   interval,
+		Tiles:      tiles,
+		Columns:    columns,
+		Rows:       rows,
+		TileWidth:  tileWidth,
+		TileHeight: tileHeight,
+	}, nil
+}
+
+// writeVTT 写入 WebVTT 缩略图轨道,每个时间段引用雪碧图中的一格(媒体片段 #xywh)
+// 雪碧图使用相对路径,WebVTT 与雪碧图需放在同一目录
+func writeVTT(path, spriteName string, duration, interval float64, tiles, columns, tileWidth, tileHeight int) error {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n")
+	for i := 0; i < tiles; i++ {
+		start := float64(i) * interval
+		end := min(start+interval, duration)
+		x := (i % columns) * tileWidth
+		y := (i / columns) * tileHeight
+		fmt.Fprintf(&b, "\n%s --> %s\n%s#xywh=%d,%d,%d,%d\n",
+			vttTimestamp(start), vttTimestamp(end), spriteName, x, y, tileWidth, tileHeight)
+	}
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+// imageArgs 按图片扩展名生成编码参数
+func imageArgs(path string) []string {
+	if strings.EqualFold(filepath.Ext(path), ".png") {
+		return []string{"-c:v", "png"}
+	}
+	// -q:v 2 为较高的 JPEG 质量;-pix_fmt 避免部分输入的 yuv444/yuv422 导致兼容性问题
+	return []string{"-c:v", "mjpeg", "-q:v", "2", "-pix_fmt", "yuvj420p"}
+}
+
+// vttTimestamp 格式化 WebVTT 时间戳 HH:MM:SS.mmm
+func vttTimestamp(seconds float64) string {
+	ms := int64(math.Round(seconds * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// formatSeconds 格式化 FFmpeg 时间参数
+func formatSeconds(seconds float64) string {
+	return strconv.FormatFloat(seconds, 'f', 3, 64)
+}
+
+// roundTime 时间点保留到毫秒
+func roundTime(seconds float64) float64 {
+	return math.Round(seconds*1000) / 1000
+}
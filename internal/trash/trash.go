@@ -0,0 +1,191 @@
+package trash
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// purgeInterval 检查过期文件的间隔
+const purgeInterval = 10 * time.Minute
+
+// Trash 回收站
+// 文件移入后保留 retention 时长,期间可以恢复,过期后自动清除
+type Trash struct {
+	dir       string
+	retention time.Duration
+	stopCh    chan struct{}
+}
+
+// New 创建回收站
+// retention <= 0 时不保留,Move 直接删除文件
+func New(dir string, retention time.Duration) *Trash {
+	return &Trash{
+		dir:       dir,
+		retention: retention,
+		stopCh:    make(chan struct{}),
+	}
+}
+
+// Retention 返回文件保留时长
+func (t *Trash) Retention() time.Duration {
+	return t.retention
+}
+
+// Move 将文件移入回收站,返回文件在回收站中的路径
+// 未启用保留时直接删除文件并返回空路径
+func (t *Trash) Move(path string) (string, error) {
+	if t.retention <= 0 {
+		if err := os.Remove(path); err != nil {
+			return "", fmt.Errorf("删除文件失败: %v", err)
+		}
+		return "", nil
+	}
+
+	if err := os.MkdirAll(t.dir, 0755); err != nil {
+		return "", fmt.Errorf("创建回收站目录失败: %v", err)
+	}
+
+	// 以移入时间为前缀,避免同名文件冲突
+	trashedPath := filepath.Join(t.dir, fmt.Sprintf("%d_%s", time.Now().UnixNano(), filepath.Base(path)))
+	if err := moveFile(path, trashedPath); err != nil {
+		return "", fmt.Errorf("移入回收站失败: %v", err)
+	}
+
+	// 过期时间以移入回收站的时间为准
+	now := time.Now()
+	os.Chtimes(trashedPath, now, now)
+
+	log.Printf("🗑️  已移入回收站: %s (保留 %s)", filepath.Base(path), t.retention)
+	return trashedPath, nil
+}
+
+// Restore 将回收站中的文件恢复到原路径
+func (t *Trash) Restore(trashedPath, originalPath string) error {
+	if !t.contains(trashedPath) {
+		return fmt.Errorf("文件不在回收站中: %s", trashedPath)
+	}
+	if _, err := os.Stat(trashedPath); err != nil {
+		return fmt.Errorf("回收站中的文件已被清除")
+	}
+	if _, err := os.Stat(originalPath); err == nil {
+		return fmt.Errorf("原路径已存在文件: %s", originalPath)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(originalPath), 0755); err != nil {
+		return fmt.Errorf("创建目录失败: %v", err)
+	}
+	if err := moveFile(trashedPath, originalPath); err != nil {
+		return fmt.Errorf("恢复文件失败: %v", err)
+	}
+
+	log.Printf("♻️  已从回收站恢复: %s", originalPath)
+	return nil
+}
+
+// Purge 清除超过保留时长的文件,返回清除的文件数
+func (t *Trash) Purge() int {
+	entries, err := os.ReadDir(t.dir)
+	if err != nil {
+		return 0
+	}
+
+	count := 0
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() {
+			continue
+		}
+		if time.Since(info.ModTime()) < t.retention {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(t.dir, entry.Name())); err != nil {
+			log.Printf("⚠️  清除回收站文件失败 %s: %v", entry.Name(), err)
+			continue
+		}
+		count++
+	}
+
+	if count > 0 {
+		log.Printf("🧹 已清除 %d 个过期的回收站文件", count)
+	}
+	return count
+}
+
+// Start 启动定期清除
+func (t *Trash) Start() {
+	if t.retention <= 0 {
+		return
+	}
+	go t.watch()
+}
+
+// Stop 停止定期清除
+func (t *Trash) Stop() {
+	close(t.stopCh)
+}
+
+// watch 定期清除过期文件
+func (t *Trash) watch() {
+	t.Purge()
+
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			t.Purge()
+		case <-t.stopCh:
+			return
+		}
+	}
+}
+
+// contains 检查路径是否位于回收站目录中
+func (t *Trash) contains(path string) bool {
+	dir, err := filepath.Abs(t.dir)
+	if err != nil {
+		return false
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(dir, abs)
+	return err == nil && rel != "." && !strings.HasPrefix(rel, "..")
+}
+
+// moveFile 移动文件,跨文件系统时退化为复制后删除
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+
+	return os.Remove(src)
+}
@@ -0,0 +1,199 @@
+package upload
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// liveIdleTimeout 等待下一个切片的最长时间,超时后实时接收失败
+// 录制端崩溃或网络中断时客户端不会调用结束接口,避免写入协程和 FFmpeg 永远等待
+const liveIdleTimeout = 5 * time.Minute
+
+// LiveFunc 实时处理函数
+// 从 r 读取按切片顺序到达的原始数据,r 返回 EOF 表示录制结束;返回即视为处理结束
+type LiveFunc func(ctx context.Context, task *UploadTask, r io.Reader) error
+
+// liveIngest 实时接收状态
+// 切片按索引顺序写入管道,乱序到达的切片等待前面的切片到齐后再写入
+type liveIngest struct {
+	pipe     *io.PipeWriter
+	raw      *os.File      // 原始数据同时写入合并文件,录制结束后作为上传的合并结果
+	next     int           // 下一个要写入的切片索引
+	notify   chan struct{} // 有新切片或录制结束时通知写入协程
+	finished bool          // 客户端已调用结束接口
+	done     chan struct{} // 处理函数返回后关闭
+}
+
+// StartLive 为上传任务启动实时接收
+// 之后上传的切片会按顺序送入 fn,调用 FinishLive 后 fn 读到 EOF
+func (m *Manager) StartLive(uploadID string, fn LiveFunc) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task, ok := m.tasks[uploadID]
+	if !ok {
+		return fmt.Errorf("上传任务不存在: %s", uploadID)
+	}
+	if task.live != nil {
+		return fmt.Errorf("上传任务已在实时接收中: %s", uploadID)
+	}
+	if task.Status != UploadStatusUploading || task.UploadedChunks > 0 {
+		return fmt.Errorf("只能在上传切片之前启动实时接收: %s", uploadID)
+	}
+
+	mergedPath := m.MergedPathFor(task)
+	raw, err := os.Create(mergedPath)
+	if err != nil {
+		return fmt.Errorf("创建合并文件失败: %v", err)
+	}
+
+	pr, pw := io.Pipe()
+	live := &liveIngest{
+		pipe:   pw,
+		raw:    raw,
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	task.live = live
+	task.Live = true
+	task.MergedPath = mergedPath
+	task.UpdatedAt = time.Now()
+	m.persist(task)
+
+	go func() {
+		if err := fn(task.ctx, task, pr); err != nil {
+			log.Printf("实时处理失败: %s, %v", uploadID, err)
+		}
+		// 处理函数提前退出时让写入协程停止写入
+		pr.CloseWithError(fmt.Errorf("实时处理已结束"))
+		close(live.done)
+	}()
+	go m.feedLive(task, live)
+
+	log.Printf("📡 上传任务 %s 开始实时接收", uploadID)
+	return nil
+}
+
+// FinishLive 结束实时接收
+// totalChunks 为录制产生的切片总数,缺失的切片上传后才会送入处理函数;返回的通道在处理结束后关闭
+func (m *Manager) FinishLive(uploadID string, totalChunks int) (<-chan struct{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task, ok := m.tasks[uploadID]
+	if !ok {
+		return nil, fmt.Errorf("上传任务不存在: %s", uploadID)
+	}
+	live := task.live
+	if live == nil {
+		return nil, fmt.Errorf("上传任务未在实时接收中: %s", uploadID)
+	}
+	if totalChunks < 1 {
+		return nil, fmt.Errorf("totalChunks 必须大于 0")
+	}
+	for index := range task.chunks {
+		if index >= totalChunks {
+			return nil, fmt.Errorf("已上传的切片 %d 超出 totalChunks", index)
+		}
+	}
+
+	task.TotalChunks = totalChunks
+	task.UpdatedAt = time.Now()
+	live.finished = true
+	m.persist(task)
+	live.wake()
+
+	return live.done, nil
+}
+
+// feedLive 将已到达的连续切片依次写入合并文件和处理管道
+func (m *Manager) feedLive(task *UploadTask, live *liveIngest) {
+	err := m.writeLiveChunks(task, live)
+	live.raw.Close()
+	live.pipe.CloseWithError(err)
+	<-live.done
+
+	repaired := false
+	if err == nil {
+		repaired = m.runIngest(task, task.MergedPath)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task.live = nil
+	if _, ok := m.tasks[task.UploadID]; !ok {
+		// 上传已取消,丢弃不完整的合并文件
+		os.Remove(task.MergedPath)
+		return
+	}
+
+	task.UpdatedAt = time.Now()
+	if err != nil {
+		log.Printf("实时接收失败: %s, %v", task.UploadID, err)
+		task.Status = UploadStatusFailed
+		m.persist(task)
+		return
+	}
+
+	// 处理函数失败不影响原始数据,合并文件仍可用于普通转换
+	task.Repaired = repaired
+	task.Status = UploadStatusMerged
+	m.persist(task)
+	os.RemoveAll(task.TempDir)
+	log.Printf("✅ 实时接收完成: %s", task.UploadID)
+}
+
+// writeLiveChunks 循环写入切片,直到全部切片写完、上传被取消或等待切片超时
+// 处理函数提前退出后只继续写入合并文件
+func (m *Manager) writeLiveChunks(task *UploadTask, live *liveIngest) error {
+	piping := true
+	for {
+		m.mu.RLock()
+		ready := task.chunks[live.next]
+		complete := live.finished && live.next >= task.TotalChunks
+		m.mu.RUnlock()
+
+		if complete {
+			return nil
+		}
+		if !ready {
+			// 任何切片到达(包括乱序切片)都会重新计时
+			select {
+			case <-live.notify:
+				continue
+			case <-time.After(liveIdleTimeout):
+				return fmt.Errorf("等待切片 %d 超时: %v 内未收到新切片", live.next, liveIdleTimeout)
+			case <-task.ctx.Done():
+				return fmt.Errorf("上传已取消")
+			}
+		}
+
+		data, err := os.ReadFile(task.GetChunkPath(live.next))
+		if err != nil {
+			return fmt.Errorf("读取切片 %d 失败: %v", live.next, err)
+		}
+		if _, err := live.raw.Write(data); err != nil {
+			return fmt.Errorf("写入合并文件失败: %v", err)
+		}
+		// 管道写入会阻塞到 FFmpeg 读取,处理函数退出后返回错误
+		if piping {
+			if _, err := live.pipe.Write(data); err != nil {
+				piping = false
+			}
+		}
+		live.next++
+	}
+}
+
+// wake 通知写入协程检查新切片,不阻塞
+func (l *liveIngest) wake() {
+	select {
+	case l.notify <- struct{}{}:
+	default:
+	}
+}
@@ -2,12 +2,17 @@ package upload
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 
+	"goalfy-mediaconverter/internal/store"
+
 	"github.com/google/uuid"
 )
 
@@ -30,28 +35,143 @@ type UploadTask struct {
 	UploadedChunks int          `json:"uploadedChunks"`
 	Status         UploadStatus `json:"status"`
 	MergedPath     string       `json:"mergedPath,omitempty"`
-	TempDir        string       `json:"-"` // 临时目录,不序列化
+	Live           bool         `json:"live,omitempty"`     // 是否为实时接收(边录制边上传边转换)
+	Repaired       bool         `json:"repaired,omitempty"` // 合并后是否修复过时长和索引
+	TempDir        string       `json:"-"`                  // 临时目录,不序列化
 	CreatedAt      time.Time    `json:"createdAt"`
 	UpdatedAt      time.Time    `json:"updatedAt"`
 	ctx            context.Context
 	cancel         context.CancelFunc
 	chunks         map[int]bool // 已上传的切片索引
+	live           *liveIngest  // 实时接收状态,仅在接收过程中不为 nil
+}
+
+// storeBucket 上传记录在持久化存储中的分组名
+const storeBucket = "uploads"
+
+// uploadRecord 上传任务的持久化结构
+// 额外保存临时目录和已上传切片,以便重启后继续断点上传
+type uploadRecord struct {
+	*UploadTask
+	TempDir string `json:"tempDir"`
+	Chunks  []int  `json:"chunks"`
 }
 
 // Manager 上传管理器
 type Manager struct {
 	tasks   map[string]*UploadTask
 	mu      sync.RWMutex
-	tempDir string // 临时文件目录
-	dataDir string // 数据目录
+	tempDir string       // 临时文件目录
+	dataDir string       // 数据目录
+	store   *store.Store // 持久化存储,为 nil 时仅保存在内存中
+	ingest  IngestFunc   // 合并完成后对文件的处理,为 nil 时不处理
 }
 
+// IngestFunc 合并完成后对文件的处理(如修复 MediaRecorder 录制文件的时长和索引)
+// 返回文件是否被修改;处理失败时保留合并后的原文件
+type IngestFunc func(ctx context.Context, path string) (bool, error)
+
 // NewManager 创建上传管理器
-func NewManager(tempDir, dataDir string) *Manager {
-	return &Manager{
+// st 不为 nil 时从存储中恢复上次运行留下的上传任务
+func NewManager(tempDir, dataDir string, st *store.Store) *Manager {
+	m := &Manager{
 		tasks:   make(map[string]*UploadTask),
 		tempDir: tempDir,
 		dataDir: dataDir,
+		store:   st,
+	}
+	if st != nil {
+		m.load()
+	}
+	return m
+}
+
+// SetIngest 设置合并完成后的处理函数
+// 处理完成后上传任务才变为 merged,下游转换和切割拿到的是处理后的文件
+func (m *Manager) SetIngest(fn IngestFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ingest = fn
+}
+
+// runIngest 执行合并后的处理,返回文件是否被修改
+func (m *Manager) runIngest(task *UploadTask, path string) bool {
+	m.mu.RLock()
+	ingest := m.ingest
+	m.mu.RUnlock()
+	if ingest == nil {
+		return false
+	}
+
+	changed, err := ingest(task.ctx, path)
+	if err != nil {
+		log.Printf("⚠️  处理合并文件失败: %s, %v, 将使用原文件", task.UploadID, err)
+		return false
+	}
+	return changed
+}
+
+// load 从存储中恢复上传任务
+// 未完成的上传以磁盘上实际存在的切片为准,丢失的切片需要客户端重新上传
+func (m *Manager) load() {
+	err := m.store.Load(storeBucket, func(id string, data []byte) error {
+		record := uploadRecord{UploadTask: &UploadTask{}}
+		if err := json.Unmarshal(data, &record); err != nil {
+			return err
+		}
+
+		task := record.UploadTask
+		task.TempDir = record.TempDir
+		task.ctx, task.cancel = context.WithCancel(context.Background())
+		task.chunks = make(map[int]bool)
+
+		// 实时接收的 FFmpeg 进程已随重启终止,无法继续
+		if task.Live && task.Status == UploadStatusUploading {
+			task.Status = UploadStatusFailed
+			os.Remove(task.MergedPath)
+			os.RemoveAll(task.TempDir)
+		}
+
+		if task.Status == UploadStatusUploading {
+			if err := os.MkdirAll(task.TempDir, 0755); err != nil {
+				return fmt.Errorf("创建临时目录失败: %v", err)
+			}
+			for _, index := range record.Chunks {
+				if _, err := os.Stat(task.GetChunkPath(index)); err == nil {
+					task.chunks[index] = true
+				}
+			}
+			task.UploadedChunks = len(task.chunks)
+		}
+
+		m.tasks[task.UploadID] = task
+		return nil
+	})
+	if err != nil {
+		log.Printf("⚠️  加载上传记录失败: %v", err)
+		return
+	}
+	log.Printf("📦 已恢复 %d 个上传记录", len(m.tasks))
+}
+
+// persist 保存上传任务记录,调用方需持有锁
+func (m *Manager) persist(task *UploadTask) {
+	if m.store == nil {
+		return
+	}
+
+	record := uploadRecord{
+		UploadTask: task,
+		TempDir:    task.TempDir,
+		Chunks:     make([]int, 0, len(task.chunks)),
+	}
+	for index := range task.chunks {
+		record.Chunks = append(record.Chunks, index)
+	}
+	sort.Ints(record.Chunks)
+
+	if err := m.store.Put(storeBucket, task.UploadID, record); err != nil {
+		log.Printf("⚠️  保存上传任务 %s 失败: %v", task.UploadID, err)
 	}
 }
 
@@ -87,6 +207,7 @@ func (m *Manager) CreateUploadTask(fileName string, fileSize int64, totalChunks
 	}
 
 	m.tasks[uploadID] = task
+	m.persist(task)
 	return task, nil
 }
 
@@ -104,6 +225,10 @@ func (m *Manager) RecordChunk(uploadID string, chunkIndex int) error {
 		task.chunks[chunkIndex] = true
 		task.UploadedChunks++
 		task.UpdatedAt = time.Now()
+		m.persist(task)
+	}
+	if task.live != nil {
+		task.live.wake()
 	}
 
 	return nil
@@ -129,14 +254,20 @@ func (m *Manager) MergeChunks(uploadID string) error {
 	}
 
 	// 输出文件路径
-	mergedPath := filepath.Join(m.dataDir, uploadID+"_"+task.FileName)
+	mergedPath := m.MergedPathFor(task)
 
 	// 创建输出文件
 	outFile, err := os.Create(mergedPath)
 	if err != nil {
 		return fmt.Errorf("创建合并文件失败: %v", err)
 	}
-	defer outFile.Close()
+
+	// 合并失败时关闭并删除不完整的合并文件,切片仍保留,可以重新合并
+	fail := func(err error) error {
+		outFile.Close()
+		os.Remove(mergedPath)
+		return err
+	}
 
 	// 按顺序合并切片
 	for i := 0; i < task.TotalChunks; i++ {
@@ -144,19 +275,27 @@ func (m *Manager) MergeChunks(uploadID string) error {
 
 		chunkData, err := os.ReadFile(chunkPath)
 		if err != nil {
-			return fmt.Errorf("读取切片 %d 失败: %v", i, err)
+			return fail(fmt.Errorf("读取切片 %d 失败: %v", i, err))
 		}
 
 		if _, err := outFile.Write(chunkData); err != nil {
-			return fmt.Errorf("写入切片 %d 失败: %v", i, err)
+			return fail(fmt.Errorf("写入切片 %d 失败: %v", i, err))
 		}
 	}
+	if err := outFile.Close(); err != nil {
+		os.Remove(mergedPath)
+		return fmt.Errorf("写入合并文件失败: %v", err)
+	}
+
+	repaired := m.runIngest(task, mergedPath)
 
 	// 更新任务状态
 	m.mu.Lock()
+	task.Repaired = repaired
 	task.Status = UploadStatusMerged
 	task.MergedPath = mergedPath
 	task.UpdatedAt = time.Now()
+	m.persist(task)
 	m.mu.Unlock()
 
 	// 清理临时目录
@@ -188,15 +327,65 @@ func (m *Manager) CancelUpload(uploadID string) error {
 	}
 
 	delete(m.tasks, uploadID)
+	if m.store != nil {
+		if err := m.store.Delete(storeBucket, uploadID); err != nil {
+			log.Printf("⚠️  删除上传记录 %s 失败: %v", uploadID, err)
+		}
+	}
 	return nil
 }
 
+// MissingChunks 获取尚未上传的切片索引,用于断点续传
+func (m *Manager) MissingChunks(uploadID string) ([]int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	task, ok := m.tasks[uploadID]
+	if !ok {
+		return nil, fmt.Errorf("上传任务不存在: %s", uploadID)
+	}
+
+	missing := []int{}
+	if task.Status != UploadStatusUploading {
+		return missing, nil
+	}
+	for i := 0; i < task.TotalChunks; i++ {
+		if !task.chunks[i] {
+			missing = append(missing, i)
+		}
+	}
+	return missing, nil
+}
+
+// PendingMerges 列出切片已全部上传但尚未合并的任务(合并过程中服务重启)
+func (m *Manager) PendingMerges() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var ids []string
+	for id, task := range m.tasks {
+		if task.Status == UploadStatusUploading && task.IsComplete() {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// MergedPathFor 获取上传任务合并后的文件路径
+func (m *Manager) MergedPathFor(task *UploadTask) string {
+	return filepath.Join(m.dataDir, task.UploadID+"_"+task.FileName)
+}
+
 // GetChunkPath 获取切片文件路径
 func (t *UploadTask) GetChunkPath(chunkIndex int) string {
 	return filepath.Join(t.TempDir, fmt.Sprintf("chunk_%d", chunkIndex))
 }
 
 // IsComplete 检查是否所有切片都已上传
+// 实时接收的切片在接收过程中已写入合并文件,不需要再合并
 func (t *UploadTask) IsComplete() bool {
+	if t.Live {
+		return false
+	}
 	return t.UploadedChunks == t.TotalChunks
 }